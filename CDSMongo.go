@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
@@ -23,16 +25,11 @@ const (
 	CdsIceland = "Iceland"
 )
 
-type CDSCountryType string
-
-var CDSCountyCollectionMatrix = map[CDSCountryType]string{
-	CDSCountryType(CdsUSA):     "ConfirmUS",
-	CDSCountryType(CdsTaiwan):  "ConfirmTaiwan",
-	CDSCountryType(CdsIceland): "ConfirmIceland",
-}
-
 var defaulMognoTimeout = 5 * time.Second
 
+// latestMongoTimeout is the timeout of LatestCDSConfirm, which reads every record of a collection without a filter
+var latestMongoTimeout = 2 * time.Minute
+
 var (
 	ErrNoConfirmDataset       = fmt.Errorf("no data-set")
 	ErrInvalidConfirmDataset  = fmt.Errorf("invalid confirm data-set")
@@ -42,11 +39,82 @@ var (
 	ErrConfirmDuplicateRecord = fmt.Errorf("confirm data duplicate")
 )
 
+// PartialWriteError is returned when a bulk write fails on some records. Written counts the records which are written.
+type PartialWriteError struct {
+	Collection string
+	Written    UpsertResult
+	Failed     int
+	Err        error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("collection %s: %d records fail to write (%s): %v", e.Collection, e.Failed, e.Written, e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectionError is returned when the db can not be reached
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("db connection fail: %v", e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// classifyWriteError converts an error of a write to ErrConfirmDuplicateRecord, *PartialWriteError or *ConnectionError.
+// written is what the write has done before it fails.
+func classifyWriteError(err error, collection string, written UpsertResult) error {
+	if nil == err {
+		return nil
+	}
+	if bulkErr, ok := err.(mongo.BulkWriteException); ok {
+		if nil == bulkErr.WriteConcernError && len(bulkErr.WriteErrors) > 0 {
+			duplicate := true
+			for _, e := range bulkErr.WriteErrors {
+				if DuplicateKeyCode != e.Code {
+					duplicate = false
+					break
+				}
+			}
+			if duplicate {
+				return fmt.Errorf("%w: %v", ErrConfirmDuplicateRecord, err)
+			}
+		}
+		return &PartialWriteError{Collection: collection, Written: written, Failed: len(bulkErr.WriteErrors), Err: err}
+	}
+	if isConnectionError(err) {
+		return &ConnectionError{Err: err}
+	}
+	return err
+}
+
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, mongo.ErrClientDisconnected) {
+		return true
+	}
+	if cmdErr, ok := err.(mongo.CommandError); ok {
+		return cmdErr.HasErrorLabel("NetworkError")
+	}
+	return strings.Contains(err.Error(), "server selection error")
+}
+
 type CDSScoreDataSet struct {
 	Name       string  `json:"name" bson:"name"`
 	ReportTime int64   `json:"report_ts" bson:"report_ts"`
 	ReportDate string  `json:"report_date" bson:"report_date"`
 	Cases      float64 `json:"cases" bson:"cases"`
+	Deaths     float64 `json:"deaths" bson:"deaths"`
+	Recovered  float64 `json:"recovered" bson:"recovered"`
+	Active     float64 `json:"active" bson:"active"`
+	Population float64 `json:"population" bson:"population"`
+	Gap        bool    `json:"gap" bson:"-"` // computed over missing days
 }
 
 type PoliticalGeo struct {
@@ -55,6 +123,17 @@ type PoliticalGeo struct {
 	County  string
 }
 
+// locationName joins the country, state and county of loc which are given by -, ie. United States-California, to name output files
+func locationName(loc PoliticalGeo) string {
+	name := loc.Country
+	for _, part := range []string{loc.State, loc.County} {
+		if "" != part {
+			name = name + "-" + part
+		}
+	}
+	return name
+}
+
 func init() {
 	viper.AutomaticEnv()
 	viper.SetEnvPrefix("autonomy")
@@ -81,7 +160,12 @@ func NewMongoConnect() (*MongoClient, error) {
 	m.MongoClient = client
 	err = client.Connect(ctx)
 	if err != nil {
-		return &m, err
+		return &m, &ConnectionError{Err: err}
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, defaulMognoTimeout)
+	defer cancel()
+	if err := client.Ping(pingCtx, nil); err != nil {
+		return &m, &ConnectionError{Err: err}
 	}
 	db := default_mongo_autonomy_db
 	if len(viper.GetString("mongo.database")) > 0 {
@@ -92,140 +176,301 @@ func NewMongoConnect() (*MongoClient, error) {
 }
 func setIndex(c *MongoClient, collection string) error {
 	cdsIndex := mongo.IndexModel{
-		Keys:    bson.D{{"name", 1}, {"report_ts", 1}},
+		Keys:    bson.D{{Key: "name", Value: 1}, {Key: "report_ts", Value: 1}},
 		Options: options.Index().SetUnique(true),
 	}
 	_, err := c.UsedDB.Collection(collection).Indexes().CreateOne(context.Background(), cdsIndex)
 
 	if nil != err {
-		fmt.Println("collection", collection, "mongodb create name and report_ts combined index with error: ", err)
-		return err
+		log.Println("collection", collection, "mongodb create name and report_ts combined index with error: ", err)
+		return classifyWriteError(err, collection, UpsertResult{})
 	}
 	return nil
 }
 
-func createCDSData(c *MongoClient, result []CDSData, collection string) error {
-	data := make([]interface{}, len(result))
-	for i, v := range result {
-		data[i] = v
-	}
-	fmt.Println("createCDSData try to insert ", len(data), " record")
-	opts := options.InsertMany().SetOrdered(false)
-	res, err := c.UsedDB.Collection(collection).InsertMany(context.Background(), data, opts)
-	if err != nil {
-		if errs, hasErr := err.(mongo.BulkWriteException); hasErr {
-			if 1 == len(errs.WriteErrors) && DuplicateKeyCode == errs.WriteErrors[0].Code {
-				fmt.Println(err)
-				return nil
-			}
-		}
-	}
-	if res != nil {
-		fmt.Println("number record inserted:", len(res.InsertedIDs))
-	} else {
-		fmt.Println("no record inserted in db")
-	}
+// UpsertResult counts documents written by UpsertCDS
+type UpsertResult struct {
+	Inserted  int64
+	Modified  int64
+	Unchanged int64
+}
 
-	return nil
+func (r *UpsertResult) Add(o UpsertResult) {
+	r.Inserted += o.Inserted
+	r.Modified += o.Modified
+	r.Unchanged += o.Unchanged
+}
+
+func (r UpsertResult) String() string {
+	return fmt.Sprintf("inserted: %d modified: %d unchanged: %d", r.Inserted, r.Modified, r.Unchanged)
 }
 
-func ReplaceCDS(c *MongoClient, result []CDSData, collection string) error {
+// UpsertCDS replaces records by name and report_ts and inserts the missing ones.
+// Records are sent through BulkWrite in chunks of batchSize.
+func UpsertCDS(c *MongoClient, result []CDSData, collection string, batchSize int) (UpsertResult, error) {
+	models := make([]mongo.WriteModel, 0, len(result))
 	for _, v := range result {
-		filter := bson.M{"name": v.Name, "report_ts": v.ReportTime}
-		replacement := bson.M{
-			"name":        v.Name,
-			"city":        v.City,
-			"county":      v.County,
-			"state":       v.State,
-			"country":     v.Country,
-			"level":       v.Level,
-			"cases":       v.Cases,
-			"deaths":      v.Deaths,
-			"recovered":   v.Recovered,
-			"report_ts":   v.ReportTime,
-			"update_ts":   v.UpdateTime,
-			"report_date": v.ReportTimeDate,
-			"countryId":   v.CountryID,
-			"stateId":     v.StateID,
-			"countyId":    v.CountyID,
-			"location":    v.Location,
-			"tz":          v.Timezone,
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"name": v.Name, "report_ts": v.ReportTime}).
+			SetReplacement(v).
+			SetUpsert(true))
+	}
+	return bulkUpsert(c, collection, models, batchSize)
+}
+
+// bulkUpsert sends upsert models to collection through unordered BulkWrite in chunks of batchSize and counts the documents written.
+// The count of the chunks written before a failed chunk is returned with the error.
+func bulkUpsert(c *MongoClient, collection string, models []mongo.WriteModel, batchSize int) (UpsertResult, error) {
+	total := UpsertResult{}
+	if batchSize <= 0 {
+		batchSize = defaultHistoryBatchSize
+	}
+	opts := options.BulkWrite().SetOrdered(false)
+	for start := 0; start < len(models); start += batchSize {
+		end := start + batchSize
+		if end > len(models) {
+			end = len(models)
+		}
+		res, err := c.UsedDB.Collection(collection).BulkWrite(context.Background(), models[start:end], opts)
+		if res != nil {
+			total.Add(UpsertResult{
+				Inserted:  res.UpsertedCount,
+				Modified:  res.ModifiedCount,
+				Unchanged: res.MatchedCount - res.ModifiedCount,
+			})
 		}
-		opts := options.Replace().SetUpsert(true)
-		_, err := c.UsedDB.Collection(collection).ReplaceOne(context.Background(), filter, replacement, opts)
 		if err != nil {
-			if errs, hasErr := err.(mongo.BulkWriteException); hasErr {
-				if 1 == len(errs.WriteErrors) && DuplicateKeyCode == errs.WriteErrors[0].Code {
-					fmt.Println("cds update with error: %s", err)
-				}
-			}
+			log.Println("upsert", collection, "error:", err)
+			return total, classifyWriteError(err, collection, total)
 		}
 	}
+	return total, nil
+}
+
+// setForecastIndex makes forecasts unique by name, model, report_ts and target_ts
+func setForecastIndex(c *MongoClient) error {
+	forecastIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}, {Key: "model", Value: 1}, {Key: "report_ts", Value: 1}, {Key: "target_ts", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	_, err := c.UsedDB.Collection(forecastCollection).Indexes().CreateOne(context.Background(), forecastIndex)
+	if nil != err {
+		log.Println("collection", forecastCollection, "mongodb create forecast index with error: ", err)
+		return classifyWriteError(err, forecastCollection, UpsertResult{})
+	}
 	return nil
 }
 
-//
-func ContinuousDataCDSConfirm(c *MongoClient, loc PoliticalGeo, windowSize int64, timeBefore int64) ([]CDSScoreDataSet, error) {
+// UpsertForecasts replaces forecasts by name, model, report_ts and target_ts and inserts the missing ones, in chunks of batchSize like UpsertCDS
+func UpsertForecasts(c *MongoClient, forecasts []Forecast, batchSize int) (UpsertResult, error) {
+	models := make([]mongo.WriteModel, 0, len(forecasts))
+	for _, f := range forecasts {
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"name": f.Name, "model": f.Model, "report_ts": f.ReportTime, "target_ts": f.TargetTime}).
+			SetReplacement(f).
+			SetUpsert(true))
+	}
+	return bulkUpsert(c, forecastCollection, models, batchSize)
+}
+
+// QueryForecasts returns forecasts of loc made between from and to, sorted by name, report_ts, model and target_ts
+func QueryForecasts(c *MongoClient, loc PoliticalGeo, from int64, to int64) ([]Forecast, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), defaulMognoTimeout)
 	defer cancel()
 
-	var col *mongo.Collection
-	var filter bson.M
-	var opts *options.FindOptions
-	switch loc.Country { //  Currently this function support only USA data
-	case CdsTaiwan:
-		col = c.UsedDB.Collection(CDSCountyCollectionMatrix[CDSCountryType(CdsTaiwan)])
-		opts = options.Find().SetSort(bson.M{"report_ts": -1}).SetLimit(windowSize + 1)
-		filter = bson.M{}
-		if timeBefore > 0 {
-			filter = bson.M{"report_ts": bson.D{{"$lte", timeBefore}}}
-		}
-	case CdsIceland:
-		col = c.UsedDB.Collection(CDSCountyCollectionMatrix[CDSCountryType(CdsIceland)])
-		opts = options.Find().SetSort(bson.M{"report_ts": -1}).SetLimit(windowSize + 1)
-		filter = bson.M{}
-		if timeBefore > 0 {
-			filter = bson.M{"report_ts": bson.D{{"$lte", timeBefore}}}
-		}
-	case CdsUSA:
-		col = c.UsedDB.Collection(CDSCountyCollectionMatrix[CDSCountryType(CdsUSA)])
-		opts = options.Find().SetSort(bson.M{"report_ts": -1}).SetLimit(windowSize + 1)
-		if "" == loc.State || "" == loc.County {
-			return nil, ErrNoConfirmDataset
-		}
-		filter = bson.M{"county": loc.County, "state": loc.State}
-		if timeBefore > 0 {
-			filter = bson.M{"county": loc.County, "state": loc.State, "report_ts": bson.D{{"$lte", timeBefore}}}
-		}
+	filter := bson.M{}
+	for key, value := range forecastFilter(loc) {
+		filter[key] = value
+	}
+	reportTime := bson.M{"$gte": from}
+	if to > 0 {
+		reportTime["$lte"] = to
+	}
+	filter["report_ts"] = reportTime
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "report_ts", Value: 1}, {Key: "model", Value: 1}, {Key: "target_ts", Value: 1}})
+	cur, err := c.UsedDB.Collection(forecastCollection).Find(ctx, filter, opts)
+	if nil != err {
+		return nil, ErrConfirmDataFetch
+	}
+	defer cur.Close(ctx)
+	forecasts := []Forecast{}
+	if err := cur.All(ctx, &forecasts); err != nil {
+		return nil, ErrConfirmDecode
+	}
+	return forecasts, nil
+}
+
+// ContinuousDataCDSConfirm returns daily new cases of a location before timeBefore. The location is looked up in the country registry.
+// Missing days are handled by policy.
+func ContinuousDataCDSConfirm(c *MongoClient, loc PoliticalGeo, windowSize int64, timeBefore int64, policy GapPolicy) ([]CDSScoreDataSet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaulMognoTimeout)
+	defer cancel()
 
-	default:
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
 		return nil, ErrNoConfirmDataset
 	}
+	locFilter, err := entry.filter(loc)
+	if err != nil {
+		return nil, err
+	}
+	col := c.UsedDB.Collection(entry.Collection)
+	opts := options.Find().SetSort(bson.M{"report_ts": -1}).SetLimit(windowSize + 1)
+	filter := bson.M{}
+	for key, value := range locFilter {
+		filter[key] = value
+	}
+	if timeBefore > 0 {
+		filter["report_ts"] = bson.M{"$lte": timeBefore}
+	}
 
-	var results []CDSScoreDataSet
 	cur, err := col.Find(context.Background(), filter, opts)
 	if nil != err {
 		return nil, ErrConfirmDataFetch
 	}
+	defer cur.Close(ctx)
 
-	now := CDSScoreDataSet{}
-
+	docs := []CDSScoreDataSet{}
 	for cur.Next(ctx) {
 		var result CDSScoreDataSet
 		if errDecode := cur.Decode(&result); errDecode != nil {
 			return nil, errDecode
 		}
+		docs = append(docs, result)
+	}
+	return continuousDelta(docs, windowSize, policy), nil
+}
+
+// QueryCDSConfirm returns records of loc whose report_ts is between from and to, sorted by name and report_ts. to <= 0 means no upper bound.
+func QueryCDSConfirm(c *MongoClient, loc PoliticalGeo, from int64, to int64) ([]CDSData, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaulMognoTimeout)
+	defer cancel()
+
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	filter := bson.M{}
+	for key, value := range entry.queryFilter(loc) {
+		filter[key] = value
+	}
+	reportTime := bson.M{"$gte": from}
+	if to > 0 {
+		reportTime["$lte"] = to
+	}
+	filter["report_ts"] = reportTime
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "report_ts", Value: 1}})
+	cur, err := c.UsedDB.Collection(entry.Collection).Find(ctx, filter, opts)
+	if nil != err {
+		return nil, ErrConfirmDataFetch
+	}
+	defer cur.Close(ctx)
+	records := []CDSData{}
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, ErrConfirmDecode
+	}
+	return records, nil
+}
+
+// LatestCDSConfirm returns the latest record of each location of loc sorted by name.
+// Records are sorted in the order of the name and report_ts index, so the sort uses it, and the last of each name is the latest.
+func LatestCDSConfirm(c *MongoClient, loc PoliticalGeo) ([]CDSData, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), latestMongoTimeout)
+	defer cancel()
+
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	filter := bson.M{}
+	for key, value := range entry.queryFilter(loc) {
+		filter[key] = value
+	}
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$sort": bson.D{{Key: "name", Value: 1}, {Key: "report_ts", Value: 1}}},
+		{"$group": bson.M{"_id": "$name", "doc": bson.M{"$last": "$$ROOT"}}},
+		{"$replaceRoot": bson.M{"newRoot": "$doc"}},
+		{"$sort": bson.M{"name": 1}},
+	}
+	opts := options.Aggregate().SetAllowDiskUse(true)
+	cur, err := c.UsedDB.Collection(entry.Collection).Aggregate(ctx, pipeline, opts)
+	if nil != err {
+		return nil, ErrConfirmDataFetch
+	}
+	defer cur.Close(ctx)
+	records := []CDSData{}
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, ErrConfirmDecode
+	}
+	return records, nil
+}
+
+// continuousDelta converts cumulative cases, deaths, recovered and active sorted by report_ts in descending order to daily new ones in ascending order.
+// Days missing between two records are handled by policy, and at most windowSize days are returned.
+func continuousDelta(docs []CDSScoreDataSet, windowSize int64, policy GapPolicy) []CDSScoreDataSet {
+	var results []CDSScoreDataSet
+	now := CDSScoreDataSet{}
+	for _, result := range docs {
 		if len(now.Name) > 0 { // now data is valid
-			head := make([]CDSScoreDataSet, 1)
-			head[0] = CDSScoreDataSet{Name: now.Name, Cases: now.Cases - result.Cases, ReportTime: now.ReportTime, ReportDate: now.ReportDate}
-			results = append(head, results...)
+			results = append(gapDelta(now, result, policy), results...)
 		}
 		now = result
 	}
 	if len(results) == 0 && now.Name != "" { // only one record
 		results = append(results, now)
 	}
+	if windowSize > 0 && int64(len(results)) > windowSize {
+		results = results[int64(len(results))-windowSize:]
+	}
+	return results
+}
+
+// MongoStore is the Store backed by MongoDB
+type MongoStore struct {
+	client    *MongoClient
+	batchSize int
+}
+
+func NewMongoStore(batchSize int) (*MongoStore, error) {
+	client, err := NewMongoConnect()
+	if err != nil {
+		return nil, err
+	}
+	return &MongoStore{client: client, batchSize: batchSize}, nil
+}
+
+func (m *MongoStore) EnsureIndex(collection string) error {
+	return setIndex(m.client, collection)
+}
+
+func (m *MongoStore) Upsert(collection string, records []CDSData) (UpsertResult, error) {
+	return UpsertCDS(m.client, records, collection, m.batchSize)
+}
+
+func (m *MongoStore) ContinuousData(loc PoliticalGeo, windowSize int64, timeBefore int64, policy GapPolicy) ([]CDSScoreDataSet, error) {
+	return ContinuousDataCDSConfirm(m.client, loc, windowSize, timeBefore, policy)
+}
+
+func (m *MongoStore) Query(loc PoliticalGeo, from int64, to int64) ([]CDSData, error) {
+	return QueryCDSConfirm(m.client, loc, from, to)
+}
+
+func (m *MongoStore) Latest(loc PoliticalGeo) ([]CDSData, error) {
+	return LatestCDSConfirm(m.client, loc)
+}
+
+func (m *MongoStore) SaveForecasts(forecasts []Forecast) (UpsertResult, error) {
+	if err := setForecastIndex(m.client); err != nil {
+		return UpsertResult{}, err
+	}
+	return UpsertForecasts(m.client, forecasts, m.batchSize)
+}
+
+func (m *MongoStore) Forecasts(loc PoliticalGeo, from int64, to int64) ([]Forecast, error) {
+	return QueryForecasts(m.client, loc, from, to)
+}
 
-	cur.Close(ctx)
-	return results, nil
+func (m *MongoStore) Close() error {
+	return m.client.MongoClient.Disconnect(context.Background())
 }
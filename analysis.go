@@ -1,10 +1,9 @@
 package main
 
 import (
-	"encoding/csv"
-	"fmt"
-	"os"
-	"path"
+	"encoding/json"
+	"log"
+	"math"
 	"time"
 )
 
@@ -14,79 +13,127 @@ const (
 )
 
 type CDSDataPoint struct {
-	Name       string
-	ReportTime int64   // X - value
-	ReportDate string  // X - label
-	Score      float64 // Y-value
-	Country    string
-	State      string
-	County     string
+	Name       string  `json:"name"`
+	ReportTime int64   `json:"report_ts"`   // X - value
+	ReportDate string  `json:"report_date"` // X - label
+	Score      float64 `json:"score"`       // Y-value
+	Scorer     string  `json:"scorer"`      // score series
+	Series     string  `json:"series"`      // scored series, ie. cases / deaths / active
+	PerCapita
+	GapPoints int    `json:"gap_points"` // number of points of the window computed over missing days
+	Country   string `json:"country"`
+	State     string `json:"state"`
+	County    string `json:"county"`
+	Level     string `json:"level"`
 }
 
-func todayStartAt() int64 {
+// MarshalJSON writes a score which is not finite, ie. growthRatio after days without a case, as null, as JSON has no infinity
+func (p CDSDataPoint) MarshalJSON() ([]byte, error) {
+	type dataPoint CDSDataPoint
+	var score *float64
+	if !math.IsInf(p.Score, 0) && !math.IsNaN(p.Score) {
+		score = &p.Score
+	}
+	return json.Marshal(struct {
+		dataPoint
+		Score *float64 `json:"score"`
+	}{dataPoint(p), score})
+}
+
+// latestReportAt returns the upper bound of report_ts of the latest data. A report date is the local date of a location,
+// which is a day ahead of the UTC date east of UTC for part of the day, so it is the start of tomorrow in UTC.
+func latestReportAt() int64 {
 	curTime := time.Now().UTC()
 	start := time.Date(curTime.Year(), curTime.Month(), curTime.Day(), 0, 0, 0, 0, time.UTC)
-	return start.Unix()
+	return start.AddDate(0, 0, 1).Unix()
 }
-func ExponientialScoreOfAllTime(c *MongoClient, loc PoliticalGeo) error {
-	formula := Exponiential{}
-	timeBefore := todayStartAt()
-	fmt.Println("Today start At:", timeBefore)
+
+// ScoreOfAllTime scores every window of windowSize days of a location with each scorer and exports the score series in format to out
+func ScoreOfAllTime(store Store, loc PoliticalGeo, scorers []Scorer, windowSize int, policy GapPolicy, strategy CorrectionStrategy, format string, out string) error {
+	dataPoints, err := ScoreSeries(store, loc, scorers, windowSize, policy, strategy, 0)
+	if err != nil {
+		return err
+	}
+	err = SaveDataPoints(dataPoints, format, out)
+	if err != nil {
+		log.Println("Export Error:", err)
+		return err
+	}
+	return nil
+}
+
+// ScoreSeries scores every window of windowSize days of a location ending from the latest report back to since with each scorer.
+// Per-capita metrics of a data point are of perCapitaDays days even when the window is shorter.
+// Data points are sorted by report_ts in descending order.
+func ScoreSeries(store Store, loc PoliticalGeo, scorers []Scorer, windowSize int, policy GapPolicy, strategy CorrectionStrategy, since int64) ([]CDSDataPoint, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	dataPoints := []CDSDataPoint{}
+	timeBefore := latestReportAt()
+	log.Println("latest report at:", timeBefore)
+	days := windowSize
+	if days < perCapitaDays {
+		days = perCapitaDays
+	}
 	moreData := true
-	for moreData {
-		contData, err := ContinuousDataCDSConfirm(c, loc, defaultWindowSize, timeBefore)
+	for moreData && timeBefore >= since {
+		contData, err := store.ContinuousData(loc, int64(days), timeBefore, policy)
 		if err != nil {
-			fmt.Println("Error:", err)
-			timeBefore = timeBefore - 86400 - 1 // -1 is because timeBefore is an include function
+			log.Println("Error:", err)
+			return nil, err
 		}
 		if 0 == len(contData) {
 			moreData = false
 			continue
 		}
-		formula.Score(loc, contData)
-		timeBefore = contData[len(contData)-1].ReportTime - 1
-	}
-	err := SaveToCVS(formula.OutputDataPoint)
-	if err != nil {
-		fmt.Println("Write CVS Error:", err)
+		last := contData[len(contData)-1]
+		timeBefore = last.ReportTime - 1
+		window := contData
+		if windowSize > 0 && len(window) > windowSize {
+			window = window[len(window)-windowSize:]
+		}
+		window = cleanCorrections(window, strategy)
+		if 0 == len(window) || window[len(window)-1].ReportTime != last.ReportTime { // the day is dropped
+			continue
+		}
+		perCapita := perCapitaOf(cleanCorrections(contData, strategy))
+		gaps := gapPoints(window)
+		for _, scorer := range scorers {
+			dataPoints = append(dataPoints, CDSDataPoint{
+				Name:       last.Name,
+				ReportTime: last.ReportTime,
+				ReportDate: last.ReportDate,
+				Score:      scorer.Score(window),
+				Scorer:     scorer.Name(),
+				Series:     string(seriesOf(scorer)),
+				PerCapita:  perCapita,
+				GapPoints:  gaps,
+				Country:    loc.Country,
+				State:      loc.State,
+				County:     loc.County,
+				Level:      entry.Level,
+			})
+		}
 	}
-	return nil
+	return dataPoints, nil
 }
 
-func SaveToCVS(data []CDSDataPoint) error {
-	records := [][]string{{"name", "date", "timestamp", "score", "country", "state", "county", "level"}}
-
-	for _, record := range data {
-		cvsRecord := []string{}
-		cvsRecord = append(cvsRecord, record.Name)
-		cvsRecord = append(cvsRecord, record.ReportDate)
-		cvsRecord = append(cvsRecord, fmt.Sprintf("%d", record.ReportTime))
-		cvsRecord = append(cvsRecord, fmt.Sprintf("%f", record.Score))
-		cvsRecord = append(cvsRecord, record.Country)
-		cvsRecord = append(cvsRecord, record.State)
-		cvsRecord = append(cvsRecord, record.County)
-		fmt.Println(cvsRecord)
-		records = append(records, cvsRecord)
+// SaveDataPoints exports data points in format to out. When out is empty, the file is named by the name and date of the first data point in the data directory.
+func SaveDataPoints(data []CDSDataPoint, format string, out string) error {
+	if 0 == len(data) && "" == out {
+		log.Println("no data point to export")
+		return nil
+	}
+	name := ""
+	if len(data) > 0 {
+		name = data[0].Name + "-" + data[0].ReportDate
 	}
-	working, err := os.Getwd()
+	written, err := ExportTable(DataPointTable(data), format, out, name)
 	if err != nil {
 		return err
 	}
-	fmt.Println("length of reocrds:", len(records))
-	if len(records) > 1 {
-		filename := records[1][0] + records[1][1] + ".cvs"
-		path := path.Join(working, DataDir, filename)
-		f, err := os.Create(path)
-		if err != nil {
-			return err
-		}
-		w := csv.NewWriter(f)
-		w.WriteAll(records)
-		if err := w.Error(); err != nil {
-			return err
-		}
-		fmt.Println("write ", len(records)-1, " records to CVS")
-	}
-
+	log.Println("write", len(data), "data points to", written)
 	return nil
 }
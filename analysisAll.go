@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultAnalysisWorkers = 4
+
+// LocationError is the analysis error of a location
+type LocationError struct {
+	Location PoliticalGeo
+	Err      error
+}
+
+// AnalysisAllError reports locations which fail in analysisAll. Data points of other locations are still written.
+type AnalysisAllError struct {
+	Total  int
+	Failed []LocationError
+}
+
+func (e *AnalysisAllError) Error() string {
+	names := []string{}
+	for _, f := range e.Failed {
+		names = append(names, fmt.Sprintf("%s/%s/%s: %v", f.Location.Country, f.Location.State, f.Location.County, f.Err))
+	}
+	return fmt.Sprintf("%d of %d locations fail: %s", len(e.Failed), e.Total, strings.Join(names, "; "))
+}
+
+// LocationsOfLevel returns distinct locations of level in the collection of loc. State and county of loc narrow the locations.
+// Locations are told apart by the filter keys of the country, so the locations are the ones analysis can query.
+func LocationsOfLevel(store Store, loc PoliticalGeo, level string) ([]PoliticalGeo, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, err
+	}
+	if "" == level {
+		level = entry.Level
+	}
+	records, err := store.Latest(loc)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[PoliticalGeo]bool{}
+	locations := []PoliticalGeo{}
+	for _, r := range records {
+		if r.Level != level {
+			continue
+		}
+		l := PoliticalGeo{Country: loc.Country}
+		for _, key := range entry.FilterKeys {
+			switch key {
+			case "state":
+				l.State = r.State
+			case "county":
+				l.County = r.County
+			}
+		}
+		if seen[l] {
+			continue
+		}
+		seen[l] = true
+		locations = append(locations, l)
+	}
+	return locations, nil
+}
+
+// ScoreLocations scores locations concurrently by at most workers goroutines.
+// Data points are sorted by location, then by report_ts in descending order like ScoreSeries.
+func ScoreLocations(store Store, locations []PoliticalGeo, scorers []Scorer, windowSize int, policy GapPolicy, strategy CorrectionStrategy, workers int) ([]CDSDataPoint, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([][]CDSDataPoint, len(locations))
+	errs := make([]error, len(locations))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = ScoreSeries(store, locations[i], scorers, windowSize, policy, strategy, 0)
+			}
+		}()
+	}
+	for i := range locations {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	order := make([]int, len(locations))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		la, lb := locations[order[a]], locations[order[b]]
+		if la.State != lb.State {
+			return la.State < lb.State
+		}
+		return la.County < lb.County
+	})
+	dataPoints := []CDSDataPoint{}
+	failed := []LocationError{}
+	for _, i := range order {
+		if errs[i] != nil {
+			log.Println("analysis of", locations[i], "error:", errs[i])
+			failed = append(failed, LocationError{Location: locations[i], Err: errs[i]})
+			continue
+		}
+		dataPoints = append(dataPoints, results[i]...)
+	}
+	if len(failed) > 0 {
+		return dataPoints, &AnalysisAllError{Total: len(locations), Failed: failed}
+	}
+	return dataPoints, nil
+}
+
+// ScoreOfAllLocations scores every location of level in the collection of loc and exports the data points of all locations in format to out.
+// When out is empty, the file is named by the country, the state and the level, ie. data/United States-California-county-2020-04-20.csv.
+func ScoreOfAllLocations(store Store, loc PoliticalGeo, level string, scorers []Scorer, windowSize int, policy GapPolicy, strategy CorrectionStrategy, workers int, format string, out string) error {
+	locations, err := LocationsOfLevel(store, loc, level)
+	if err != nil {
+		return err
+	}
+	log.Println("analysisAll:", loc.Country, loc.State, "locations:", len(locations), "workers:", workers)
+	dataPoints, scoreErr := ScoreLocations(store, locations, scorers, windowSize, policy, strategy, workers)
+	if len(dataPoints) > 0 && "" == out {
+		if "" == level {
+			level = dataPoints[0].Level
+		}
+		written, err := ExportTable(DataPointTable(dataPoints), format, "", locationName(loc)+"-"+level+"-"+dataPoints[0].ReportDate)
+		if err != nil {
+			return err
+		}
+		log.Println("write", len(dataPoints), "data points to", written)
+	} else if err := SaveDataPoints(dataPoints, format, out); err != nil {
+		return err
+	}
+	return scoreErr
+}
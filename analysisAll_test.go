@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func usHistoryStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	store := NewMemoryStore()
+	if err := CDSHistoryToDB(store, path.Join("testdata", "timeseries-byLocation.json"), PoliticalGeo{Country: CdsUSA}, 0); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestLocationsOfLevel(t *testing.T) {
+	store := usHistoryStore(t)
+	locations, err := LocationsOfLevel(store, PoliticalGeo{Country: CdsUSA}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 3 {
+		t.Errorf("locations %v, want 3 counties", locations)
+	}
+	locations, _ = LocationsOfLevel(store, PoliticalGeo{Country: CdsUSA, State: "California"}, "county")
+	want := []PoliticalGeo{
+		{Country: CdsUSA, State: "California", County: "Alameda County"},
+		{Country: CdsUSA, State: "California", County: "Santa Clara County"},
+	}
+	if len(locations) != len(want) || locations[0] != want[0] || locations[1] != want[1] {
+		t.Errorf("locations %v, want %v", locations, want)
+	}
+	if locations, _ := LocationsOfLevel(store, PoliticalGeo{Country: CdsUSA}, "state"); len(locations) != 0 {
+		t.Errorf("locations %v of state level, want none", locations)
+	}
+}
+
+func TestScoreLocations(t *testing.T) {
+	store := usHistoryStore(t)
+	scorers, _ := NewScorers(ScorerExponential, 7, defaultDecay)
+	locations := []PoliticalGeo{
+		{Country: CdsUSA, State: "Washington", County: "King County"},
+		{Country: CdsUSA, State: "California"}, // no county
+		{Country: CdsUSA, State: "California", County: "Santa Clara County"},
+		{Country: CdsUSA, State: "California", County: "Alameda County"},
+	}
+	dataPoints, err := ScoreLocations(store, locations, scorers, 7, GapReport, CorrectionClamp, 2)
+	allErr := &AnalysisAllError{}
+	if !errors.As(err, &allErr) {
+		t.Fatalf("error %v, want AnalysisAllError", err)
+	}
+	if allErr.Total != 4 || len(allErr.Failed) != 1 || allErr.Failed[0].Location != locations[1] {
+		t.Errorf("failed %+v, want California without county", allErr.Failed)
+	}
+	if len(dataPoints) != 3*20 {
+		t.Fatalf("data points %d, want 60", len(dataPoints))
+	}
+	// sorted by location then report_ts in descending order
+	if dataPoints[0].County != "Alameda County" || dataPoints[20].County != "Santa Clara County" || dataPoints[40].County != "King County" {
+		t.Errorf("locations are not sorted: %s %s %s", dataPoints[0].County, dataPoints[20].County, dataPoints[40].County)
+	}
+	if dataPoints[0].ReportTime < dataPoints[1].ReportTime {
+		t.Error("data points of a location are not in descending order")
+	}
+}
+
+func TestScoreOfAllLocations(t *testing.T) {
+	dir := useDataDir(t)
+	store := usHistoryStore(t)
+	scorers, _ := NewScorers(ScorerExponential, 7, defaultDecay)
+	err := ScoreOfAllLocations(store, PoliticalGeo{Country: CdsUSA, State: "California"}, "", scorers, 7, GapReport, CorrectionClamp, 4, FormatJSONL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != "United States-California-county-2020-04-20.jsonl" {
+		t.Errorf("files %v, want one combined output", files)
+	}
+}
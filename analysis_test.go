@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestScoreOfAllTimeGolden(t *testing.T) {
+	dir := useDataDir(t)
+	store := NewMemoryStore()
+	loc := PoliticalGeo{Country: CdsIceland}
+	if err := CDSHistoryToDB(store, path.Join("testdata", "timeseries-byLocation.json"), loc, 0); err != nil {
+		t.Fatal(err)
+	}
+	scorers, err := NewScorers(defaultScorers, 7, defaultDecay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	series, _ := ParseSeries(defaultSeries)
+	scorers, err = ForSeries(scorers, series)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ScoreOfAllTime(store, loc, scorers, 7, GapReport, CorrectionClamp, FormatCSV, ""); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "Iceland-2020-04-20.csv" {
+		t.Fatalf("files %v in data dir, want Iceland-2020-04-20.csv", files)
+	}
+	got, err := ioutil.ReadFile(path.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := path.Join("testdata", "golden", "scoreOfAllTime.csv")
+	if *update {
+		if err := os.MkdirAll(path.Dir(golden), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("score output is different from %s, run go test -update to refresh it\n%s", golden, got)
+	}
+}
+
+func TestScoreSeriesPerCapita(t *testing.T) {
+	store := NewMemoryStore()
+	cumulative := []float64{}
+	for day := 0; day < 20; day++ {
+		cumulative = append(cumulative, float64(10*day))
+	}
+	store.Upsert("ConfirmIceland", dailySeries(CdsIceland, "2020-04-01", cumulative...))
+
+	// 14 days of 10 new cases a day per 100k population, with a window of 7 days
+	dataPoints, err := ScoreSeries(store, PoliticalGeo{Country: CdsIceland}, []Scorer{MovingAverage{Days: 7}}, 7, GapReport, CorrectionClamp, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if 0 == len(dataPoints) {
+		t.Fatal("no data point")
+	}
+	if p := dataPoints[0]; p.Score != 10 || p.CasesPer100k7 != 70 || p.CasesPer100k14 != 140 {
+		t.Errorf("data point %+v, want 70 cases per 100k of 7 days and 140 of 14 days", p)
+	}
+}
+
+func TestScoreSeriesLocalDate(t *testing.T) {
+	// at 20:00 UTC, it is tomorrow in Taipei, and the daily record is dated tomorrow
+	now := time.Now().UTC()
+	tomorrow := convertUTCToLocalDate([]string{"Asia/Taipei"}, time.Date(now.Year(), now.Month(), now.Day(), 20, 0, 0, 0, time.UTC))
+	records := dailySeries(CdsTaiwan, tomorrow, 10)
+	history := dailySeries(CdsTaiwan, "2020-04-01", 1, 2, 3)
+	records[0].Timezone = []string{"Asia/Taipei"}
+	store := NewMemoryStore()
+	store.Upsert("ConfirmTaiwan", append(history, records...))
+
+	loc := PoliticalGeo{Country: CdsTaiwan}
+	dataPoints, err := ScoreSeries(store, loc, []Scorer{MovingAverage{Days: 7}}, 7, GapReport, CorrectionClamp, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if 0 == len(dataPoints) || dataPoints[0].ReportDate != tomorrow {
+		t.Errorf("data points %+v, want the record of %s first", dataPoints, tomorrow)
+	}
+	si, _ := GammaSerialInterval(defaultSIMean, defaultSISD)
+	estimates, err := RtSeries(store, loc, si, 2, CorrectionClamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if 0 == len(estimates) || estimates[0].ReportDate != tomorrow {
+		t.Errorf("estimates %+v, want the record of %s first", estimates, tomorrow)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	// defaultAnomalyThreshold is the robust z-score of Iglewicz and Hoaglin over which a value is an outlier
+	defaultAnomalyThreshold = 3.5
+	// anomalyHistoryDays is the number of days before a record it is compared with
+	anomalyHistoryDays = 14
+	// minAnomalyHistory is the number of daily deltas in the history a jump check needs
+	minAnomalyHistory = 5
+	// minAnomalyJump is the daily growth over the median of the history a jump needs, so a few cases after days without any are not a jump
+	minAnomalyJump = 10.0
+	// reviewSuffix names the review collection of a collection, ie. ConfirmTaiwanReview
+	reviewSuffix = "Review"
+)
+
+// Anomaly is an incoming record which does not fit the recent history of its location
+type Anomaly struct {
+	Record  CDSData
+	Reasons []string
+}
+
+func (a Anomaly) String() string {
+	return fmt.Sprintf("%s %s: %s", a.Record.Name, a.Record.ReportTimeDate, strings.Join(a.Reasons, "; "))
+}
+
+// CheckAnomalies compares each record with the records of its location reported in the anomalyHistoryDays days before it,
+// and returns the records which pass and the anomalies. Records of loc are read from store once. State and county of loc are optional.
+// A record is an anomaly when cumulative cases or deaths decrease, drop to zero, or grow by more than the usual daily growth of the history
+// by a robust z-score over threshold and by minAnomalyJump. A jump is checked only when the history has minAnomalyHistory daily deltas.
+func CheckAnomalies(store Store, loc PoliticalGeo, records []CDSData, threshold float64) ([]CDSData, []Anomaly, error) {
+	if 0 == len(records) {
+		return records, nil, nil
+	}
+	from, to := records[0].ReportTime, records[0].ReportTime
+	for _, r := range records {
+		from = min64(from, r.ReportTime)
+		to = max64(to, r.ReportTime)
+	}
+	stored, err := store.Query(loc, from-anomalyHistoryDays*secondsOfDay, to-1)
+	if err != nil {
+		return nil, nil, err
+	}
+	histories := map[string][]CDSData{}
+	for _, s := range stored { // sorted by report_ts
+		histories[s.Name] = append(histories[s.Name], s)
+	}
+	accepted := []CDSData{}
+	anomalies := []Anomaly{}
+	for _, r := range records {
+		history := []CDSData{}
+		for _, h := range histories[r.Name] {
+			if h.ReportTime < r.ReportTime && h.ReportTime >= r.ReportTime-anomalyHistoryDays*secondsOfDay {
+				history = append(history, h)
+			}
+		}
+		reasons := anomalyReasons(r, history, threshold)
+		if len(reasons) > 0 {
+			anomalies = append(anomalies, Anomaly{Record: r, Reasons: reasons})
+			continue
+		}
+		accepted = append(accepted, r)
+	}
+	return accepted, anomalies, nil
+}
+
+// anomalyReasons checks cases and deaths of a record against its history sorted by report_ts in ascending order
+func anomalyReasons(r CDSData, history []CDSData, threshold float64) []string {
+	if 0 == len(history) {
+		return nil
+	}
+	reasons := []string{}
+	for _, field := range []struct {
+		name  string
+		value func(CDSData) float64
+	}{
+		{"cases", func(d CDSData) float64 { return d.Cases }},
+		{"deaths", func(d CDSData) float64 { return d.Deaths }},
+	} {
+		last := history[len(history)-1]
+		value, lastValue := field.value(r), field.value(last)
+		switch {
+		case 0 == value && lastValue > 0:
+			reasons = append(reasons, fmt.Sprintf("%s dropped to zero from %v on %s", field.name, lastValue, last.ReportTimeDate))
+		case value < lastValue:
+			reasons = append(reasons, fmt.Sprintf("%s decreased from %v on %s to %v", field.name, lastValue, last.ReportTimeDate, value))
+		default:
+			deltas := []float64{}
+			for i := 1; i < len(history); i++ {
+				deltas = append(deltas, dailyDelta(history[i-1], history[i], field.value))
+			}
+			if len(deltas) < minAnomalyHistory {
+				continue
+			}
+			delta := dailyDelta(last, r, field.value)
+			if z := robustZScore(delta, deltas); z > threshold && delta-median(deltas) >= minAnomalyJump {
+				reasons = append(reasons, fmt.Sprintf("%s jumped by %v a day since %s, robust z-score %.1f", field.name, delta, last.ReportTimeDate, z))
+			}
+		}
+	}
+	return reasons
+}
+
+// dailyDelta is the growth of a value from prev to now per day, so a gap of days is not a jump
+func dailyDelta(prev, now CDSData, value func(CDSData) float64) float64 {
+	days := float64(now.ReportTime-prev.ReportTime) / secondsOfDay
+	if days < 1 {
+		days = 1
+	}
+	return (value(now) - value(prev)) / days
+}
+
+// robustZScore is the modified z-score of Iglewicz and Hoaglin of x, by the median and the median absolute deviation of values.
+// Daily counts vary by about the square root of their level like Poisson counts, so the deviation is at least sqrt(median+1),
+// which also keeps the score finite when values are all the same, ie. no new case for days.
+func robustZScore(x float64, values []float64) float64 {
+	med := median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - med)
+	}
+	mad := math.Max(median(deviations), math.Sqrt(math.Abs(med)+1))
+	return 0.6745 * (x - med) / mad
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if 0 == n%2 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[n/2]
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
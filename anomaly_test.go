@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCheckAnomalies(t *testing.T) {
+	store := NewMemoryStore()
+	// 10 new cases a day, with some noise
+	store.Upsert("ConfirmTaiwan", dailySeries(CdsTaiwan, "2020-04-01", 100, 110, 121, 130, 141, 150, 160, 169, 180, 190))
+	incoming := func(cases, deaths float64) []CDSData {
+		records := dailySeries(CdsTaiwan, "2020-04-11", cases)
+		records[0].Deaths = deaths
+		return records
+	}
+	cases := []struct {
+		name   string
+		record []CDSData
+		reason string
+	}{
+		{"normal", incoming(201, 0), ""},
+		{"after a gap", dailySeries(CdsTaiwan, "2020-04-14", 230), ""},
+		{"zero", incoming(0, 0), "cases dropped to zero"},
+		{"decrease", incoming(185, 0), "cases decreased from 190"},
+		{"jump", incoming(400, 0), "cases jumped by 210 a day"},
+	}
+	for _, c := range cases {
+		accepted, anomalies, err := CheckAnomalies(store, PoliticalGeo{Country: CdsTaiwan}, c.record, defaultAnomalyThreshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if "" == c.reason {
+			if len(accepted) != 1 || len(anomalies) != 0 {
+				t.Errorf("%s: anomalies %v, want none", c.name, anomalies)
+			}
+			continue
+		}
+		if len(accepted) != 0 || len(anomalies) != 1 || !strings.Contains(anomalies[0].String(), c.reason) {
+			t.Errorf("%s: anomalies %v, want %s", c.name, anomalies, c.reason)
+		}
+	}
+
+	// a few cases after days without any are not a jump, but an outbreak is
+	quiet := NewMemoryStore()
+	quiet.Upsert("ConfirmIceland", dailySeries(CdsIceland, "2020-04-01", 5, 5, 5, 5, 5, 5, 5, 5))
+	for _, c := range []struct {
+		cases     float64
+		anomalies int
+	}{{11, 0}, {55, 1}} {
+		_, anomalies, _ := CheckAnomalies(quiet, PoliticalGeo{Country: CdsIceland}, dailySeries(CdsIceland, "2020-04-09", c.cases), defaultAnomalyThreshold)
+		if len(anomalies) != c.anomalies {
+			t.Errorf("anomalies %v of %v cases after an all-zero history, want %d", anomalies, c.cases, c.anomalies)
+		}
+	}
+
+	// no history, no check
+	accepted, anomalies, _ := CheckAnomalies(store, PoliticalGeo{Country: CdsTaiwan}, dailySeries(CdsTaiwan, "2020-06-01", 0), defaultAnomalyThreshold)
+	if len(accepted) != 1 || len(anomalies) != 0 {
+		t.Errorf("anomalies %v without history, want none", anomalies)
+	}
+}
+
+func TestRobustZScore(t *testing.T) {
+	if z := robustZScore(30, []float64{2, 6, 10, 14, 18, 22, 10}); !almostEqual(z, 0.6745*20/4) {
+		t.Errorf("z-score %v", z)
+	}
+	// the deviation is at least the square root of the level
+	if z := robustZScore(30, []float64{8, 10, 12, 10, 9}); !almostEqual(z, 0.6745*20/math.Sqrt(11)) {
+		t.Errorf("z-score %v of a steady history", z)
+	}
+	if z := robustZScore(2, []float64{0, 0, 0, 0, 0}); !almostEqual(z, 0.6745*2) {
+		t.Errorf("z-score %v of constant history", z)
+	}
+}
+
+func TestCDSDailyUpdateQuarantine(t *testing.T) {
+	loc := PoliticalGeo{Country: CdsIceland}
+	probe := NewMemoryStore()
+	if err := CDSDailyUpdate(probe, path.Join("testdata", "dataDaily.json"), loc); err != nil {
+		t.Fatal(err)
+	}
+	daily := probe.Records("ConfirmIceland")[0]
+
+	// the stored history has more cases than the incoming day
+	store := NewMemoryStore()
+	history := dailySeries(CdsIceland, "2020-04-01", 3000, 3010, 3020)
+	for i := range history {
+		history[i].Name = daily.Name
+		history[i].ReportTime = daily.ReportTime - int64(3-i)*secondsOfDay
+	}
+	store.Upsert("ConfirmIceland", history)
+	if err := CDSDailyUpdate(store, path.Join("testdata", "dataDaily.json"), loc); err != nil {
+		t.Fatal(err)
+	}
+	if records := store.Records("ConfirmIceland"); len(records) != 3 {
+		t.Errorf("records %+v, want the history only", records)
+	}
+	if review := store.Records("ConfirmIceland" + reviewSuffix); len(review) != 1 || review[0].Cases != 2566 {
+		t.Errorf("review records %+v, want the daily record", review)
+	}
+
+	anomalyThreshold = 0
+	defer func() { anomalyThreshold = defaultAnomalyThreshold }()
+	if err := CDSDailyUpdate(store, path.Join("testdata", "dataDaily.json"), loc); err != nil {
+		t.Fatal(err)
+	}
+	if records := store.Records("ConfirmIceland"); len(records) != 4 {
+		t.Errorf("records %+v, want the daily record written without the check", records)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultAPIAddr   = ":8080"
+	apiTimeout       = time.Minute
+	apiShutdownLimit = 10 * time.Second
+)
+
+// APILocation is a location of a collection with its latest report
+type APILocation struct {
+	Name       string  `json:"name"`
+	Country    string  `json:"country"`
+	State      string  `json:"state"`
+	County     string  `json:"county"`
+	Level      string  `json:"level"`
+	Population float64 `json:"population"`
+	ReportTime int64   `json:"report_ts"`
+	ReportDate string  `json:"report_date"`
+}
+
+// APIServer serves records and scores of a store over HTTP. Scores use the analysis settings of the server unless a request overrides them.
+type APIServer struct {
+	Store      Store
+	Scorers    string
+	Series     string
+	WindowSize int
+	Decay      float64
+	Policy     GapPolicy
+	Strategy   CorrectionStrategy
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// Handler routes
+//
+//	GET /locations?country=&state=&county=
+//	GET /series?country=&state=&county=&from=&to=
+//	GET /latest?country=&state=&county=
+//	GET /scores?country=&state=&county=&from=&to=&scorers=&series=&window=
+//
+// from and to are dates like 2020-04-20 and optional.
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/locations", s.get(s.locations))
+	mux.HandleFunc("/series", s.get(s.series))
+	mux.HandleFunc("/latest", s.get(s.latest))
+	mux.HandleFunc("/scores", s.get(s.scores))
+	return mux
+}
+
+// get accepts GET requests of a registered country and writes the result of h as JSON
+func (s *APIServer) get(h func(loc PoliticalGeo, r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "method not allowed"})
+			return
+		}
+		query := r.URL.Query()
+		loc := PoliticalGeo{Country: query.Get("country"), State: query.Get("state"), County: query.Get("county")}
+		if _, err := registry.Lookup(loc.Country); err != nil {
+			writeJSON(w, http.StatusNotFound, apiError{Error: fmt.Sprintf("%v: %s", err, loc.Country)})
+			return
+		}
+		result, err := h(loc, r)
+		var paramErr *apiParamError
+		switch {
+		case errors.As(err, &paramErr), errors.Is(err, ErrNoConfirmDataset):
+			writeJSON(w, http.StatusBadRequest, apiError{Error: err.Error()})
+		case err != nil:
+			log.Println("api", r.URL, "error:", err)
+			writeJSON(w, http.StatusInternalServerError, apiError{Error: err.Error()})
+		default:
+			writeJSON(w, http.StatusOK, result)
+		}
+	}
+}
+
+func (s *APIServer) locations(loc PoliticalGeo, r *http.Request) (interface{}, error) {
+	records, err := s.Store.Latest(loc)
+	if err != nil {
+		return nil, err
+	}
+	locations := []APILocation{}
+	for _, r := range records {
+		locations = append(locations, APILocation{
+			Name:       r.Name,
+			Country:    r.Country,
+			State:      r.State,
+			County:     r.County,
+			Level:      r.Level,
+			Population: r.Population,
+			ReportTime: r.ReportTime,
+			ReportDate: r.ReportTimeDate,
+		})
+	}
+	return locations, nil
+}
+
+func (s *APIServer) series(loc PoliticalGeo, r *http.Request) (interface{}, error) {
+	from, to, err := dateRange(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.Query(loc, from, to)
+}
+
+func (s *APIServer) latest(loc PoliticalGeo, r *http.Request) (interface{}, error) {
+	return s.Store.Latest(loc)
+}
+
+func (s *APIServer) scores(loc PoliticalGeo, r *http.Request) (interface{}, error) {
+	from, to, err := dateRange(r)
+	if err != nil {
+		return nil, err
+	}
+	query := r.URL.Query()
+	names := s.Scorers
+	if "" != query.Get("scorers") {
+		names = query.Get("scorers")
+	}
+	window := s.WindowSize
+	if "" != query.Get("window") {
+		window, err = strconv.Atoi(query.Get("window"))
+		if err != nil || window <= 0 {
+			return nil, &apiParamError{fmt.Sprintf("invalid window %s", query.Get("window"))}
+		}
+	}
+	scorers, err := NewScorers(names, window, s.Decay)
+	if err != nil {
+		return nil, &apiParamError{err.Error()}
+	}
+	seriesNames := s.Series
+	if "" != query.Get("series") {
+		seriesNames = query.Get("series")
+	}
+	if "" != seriesNames {
+		series, err := ParseSeries(seriesNames)
+		if err != nil {
+			return nil, &apiParamError{err.Error()}
+		}
+		scorers, err = ForSeries(scorers, series)
+		if err != nil {
+			return nil, &apiParamError{err.Error()}
+		}
+	}
+	dataPoints, err := ScoreSeries(s.Store, loc, scorers, window, s.Policy, s.Strategy, from)
+	if err != nil {
+		return nil, err
+	}
+	result := []CDSDataPoint{}
+	for _, p := range dataPoints {
+		if p.ReportTime >= from && (to <= 0 || p.ReportTime <= to) {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+type apiParamError struct {
+	message string
+}
+
+func (e *apiParamError) Error() string {
+	return e.message
+}
+
+// dateRange returns report_ts of the from and to parameters. to is 0 when it is not given.
+func dateRange(r *http.Request) (int64, int64, error) {
+	from, to, err := parseDateRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		return 0, 0, &apiParamError{err.Error()}
+	}
+	return from, to, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("api write response error:", err)
+	}
+}
+
+// newAPIServer returns the API server of store with the analysis settings of flags
+func newAPIServer(store Store) (*APIServer, error) {
+	scorers, err := NewScorers(scorerNames, windowSize, decay)
+	if err != nil {
+		return nil, err
+	}
+	series, err := ParseSeries(seriesNames)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ForSeries(scorers, series); err != nil {
+		return nil, err
+	}
+	policy, err := ParseGapPolicy(gapPolicy)
+	if err != nil {
+		return nil, err
+	}
+	strategy, err := ParseCorrectionStrategy(correctionStrategy)
+	if err != nil {
+		return nil, err
+	}
+	return &APIServer{Store: store, Scorers: scorerNames, Series: seriesNames, WindowSize: windowSize, Decay: decay, Policy: policy, Strategy: strategy}, nil
+}
+
+// serveAPI serves the API on addr until stop is closed, and waits for requests in flight
+func serveAPI(server *APIServer, addr string, stop <-chan struct{}) error {
+	httpServer := &http.Server{
+		Addr:         addr,
+		Handler:      server.Handler(),
+		ReadTimeout:  apiTimeout,
+		WriteTimeout: apiTimeout,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-stop
+		log.Println("api: stop")
+		ctx, cancel := context.WithTimeout(context.Background(), apiShutdownLimit)
+		defer cancel()
+		httpServer.Shutdown(ctx) // wait for requests in flight
+	}()
+	log.Println("api: listen on", addr)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	<-done
+	return nil
+}
+
+// stopOnSignal returns a channel which is closed on the first SIGINT or SIGTERM.
+// The handler is removed then, so a second signal kills the process.
+func stopOnSignal() <-chan struct{} {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		log.Println("stop by", sig)
+		close(stop)
+	}()
+	return stop
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func testAPIServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	store := NewMemoryStore()
+	file := path.Join("testdata", "timeseries-byLocation.json")
+	for _, country := range []string{CdsUSA, CdsIceland} {
+		if err := CDSHistoryToDB(store, file, PoliticalGeo{Country: country}, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := APIServer{Store: store, Scorers: ScorerExponential, WindowSize: 7, Decay: defaultDecay, Policy: GapReport, Strategy: CorrectionClamp}
+	s := httptest.NewServer(server.Handler())
+	t.Cleanup(s.Close)
+	return s
+}
+
+func getJSON(t *testing.T, url string, status int, v interface{}) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		t.Fatalf("%s status %d, want %d", url, resp.StatusCode, status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPILocations(t *testing.T) {
+	s := testAPIServer(t)
+	locations := []APILocation{}
+	getJSON(t, s.URL+"/locations?country=United+States&state=California", http.StatusOK, &locations)
+	if len(locations) != 2 || locations[0].Name != "Alameda County, California, United States" || locations[0].ReportDate != "2020-04-20" {
+		t.Errorf("locations %+v", locations)
+	}
+}
+
+func TestAPISeries(t *testing.T) {
+	s := testAPIServer(t)
+	records := []map[string]interface{}{}
+	getJSON(t, s.URL+"/series?country=Iceland&from=2020-04-05&to=2020-04-10", http.StatusOK, &records)
+	if len(records) != 6 {
+		t.Fatalf("records %d, want 6", len(records))
+	}
+	if records[0]["report_date"] != "2020-04-05" || records[5]["report_date"] != "2020-04-10" {
+		t.Errorf("records from %v to %v", records[0]["report_date"], records[5]["report_date"])
+	}
+	for _, key := range []string{"name", "cases", "deaths", "report_ts", "countryId", "population"} {
+		if _, ok := records[0][key]; !ok {
+			t.Errorf("record has no field %s", key)
+		}
+	}
+}
+
+func TestAPILatest(t *testing.T) {
+	s := testAPIServer(t)
+	records := []CDSData{}
+	getJSON(t, s.URL+"/latest?country=United+States&state=California&county=Santa+Clara+County", http.StatusOK, &records)
+	if len(records) != 1 || records[0].County != "Santa Clara County" || records[0].ReportTimeDate != "2020-04-20" {
+		t.Errorf("records %+v", records)
+	}
+}
+
+func TestAPIScores(t *testing.T) {
+	s := testAPIServer(t)
+	points := []CDSDataPoint{}
+	getJSON(t, s.URL+"/scores?country=Iceland&from=2020-04-15&scorers=exponential,movingAverage", http.StatusOK, &points)
+	if len(points) != 12 {
+		t.Fatalf("points %d, want 6 days of 2 scorers", len(points))
+	}
+	if points[0].ReportDate != "2020-04-20" || points[0].Population != 364134 {
+		t.Errorf("point %+v", points[0])
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	s := testAPIServer(t)
+	cases := []struct {
+		url    string
+		status int
+	}{
+		{"/latest?country=Germany", http.StatusNotFound},
+		{"/series?country=Iceland&from=20200401", http.StatusBadRequest},
+		{"/scores?country=Iceland&window=0", http.StatusBadRequest},
+		{"/scores?country=Iceland&scorers=unknown", http.StatusBadRequest},
+		{"/scores?country=United+States", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		e := apiError{}
+		getJSON(t, s.URL+c.url, c.status, &e)
+		if "" == e.Error {
+			t.Errorf("%s has no error message", c.url)
+		}
+	}
+	resp, err := http.Post(s.URL+"/latest?country=Iceland", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("status %d, want 405", resp.StatusCode)
+	}
+}
+
+func TestServeAPIStop(t *testing.T) {
+	stop := stopOnSignal()
+	done := make(chan error)
+	go func() {
+		done <- serveAPI(&APIServer{Store: NewMemoryStore()}, "127.0.0.1:0", stop)
+	}()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("api is not stopped by SIGTERM")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	MetricSpearman = "spearman"
+	MetricMAE      = "mae"
+	MetricCoverage = "coverage"
+
+	// minBacktestDays is the number of evaluated days a rank correlation needs
+	minBacktestDays = 3
+	// backtestHistoryDays is the number of days of daily new cases a backtest reads. It is longer than any CDS history,
+	// so the realized growth covers every day ScoreSeries replays.
+	backtestHistoryDays = 10 * 365
+)
+
+// BacktestMetric is an evaluation metric of a model of a location over the days From to To.
+// A model is a scorer of a series, or a forecast model of cases.
+type BacktestMetric struct {
+	Name    string  `json:"name"`
+	Country string  `json:"country"`
+	State   string  `json:"state"`
+	County  string  `json:"county"`
+	Level   string  `json:"level"`
+	Model   string  `json:"model"`
+	Series  string  `json:"series"`
+	Metric  string  `json:"metric"`
+	Value   float64 `json:"value"`
+	Days    int     `json:"days"` // number of evaluated days
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+}
+
+// realizedGrowth returns the log growth of a series from the horizon days up to a day to the horizon days after it, by report_ts of the day.
+// daily is daily new counts of every day sorted by report_ts in ascending order, and 1 is added to both sums so days without new counts have growth.
+// Days without horizon days before and after them have no growth.
+func realizedGrowth(daily []CDSScoreDataSet, series Series, horizon int) map[int64]float64 {
+	values := series.of(daily)
+	growth := map[int64]float64{}
+	for i := horizon - 1; i+horizon < len(values); i++ {
+		past, future := 0.0, 0.0
+		for k := 0; k < horizon; k++ {
+			past += values[i-k].Cases
+			future += values[i+1+k].Cases
+		}
+		growth[values[i].ReportTime] = math.Log(future+1) - math.Log(past+1)
+	}
+	return growth
+}
+
+// pastSum returns the sum of daily new cases of the horizon days up to index i of daily
+func pastSum(daily []CDSScoreDataSet, i int, horizon int) float64 {
+	sum := 0.0
+	for k := 0; k < horizon && i-k >= 0; k++ {
+		sum += daily[i-k].Cases
+	}
+	return sum
+}
+
+// BacktestLocation replays the history of a location between from and to day by day. On each day, each scorer scores and the forecast model forecasts
+// with data reported at or before the day only, like they would have on the day.
+// Scores and forecast growth are compared with the realized growth of the horizon days after the day by Spearman rank correlation,
+// and forecast cumulative cases of the horizon day with the reported ones by the mean absolute error and the coverage of the prediction interval.
+// Missing days are interpolated for the realized growth, and CorrectionDrop is taken as CorrectionClamp, as the growth needs new cases of every day.
+// History is read from store once, and forecasts are fitted on windowSize days of it up to each day.
+func BacktestLocation(store Store, loc PoliticalGeo, scorers []Scorer, windowSize int, policy GapPolicy, strategy CorrectionStrategy, horizon int, from int64, to int64) ([]BacktestMetric, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	if CorrectionDrop == strategy {
+		strategy = CorrectionClamp
+	}
+	raw, err := store.ContinuousData(loc, backtestHistoryDays, latestReportAt(), GapInterpolate)
+	if err != nil {
+		return nil, err
+	}
+	daily := cleanCorrections(raw, strategy)
+	if 0 == len(daily) {
+		return nil, nil
+	}
+	name := daily[len(daily)-1].Name
+	dayIndex := map[int64]int{}
+	for i, d := range daily {
+		dayIndex[d.ReportTime] = i
+	}
+	inRange := func(t int64) bool {
+		return t >= from && (to <= 0 || t <= to)
+	}
+	metric := func(model string, series Series, kind string, value float64, days []int64) BacktestMetric {
+		return BacktestMetric{
+			Name:    name,
+			Country: loc.Country,
+			State:   loc.State,
+			County:  loc.County,
+			Level:   entry.Level,
+			Model:   model,
+			Series:  string(series),
+			Metric:  kind,
+			Value:   value,
+			Days:    len(days),
+			From:    time.Unix(days[0], 0).UTC().Format(layoutISO),
+			To:      time.Unix(days[len(days)-1], 0).UTC().Format(layoutISO),
+		}
+	}
+	metrics := []BacktestMetric{}
+
+	// scorers
+	dataPoints, err := ScoreSeries(store, loc, scorers, windowSize, policy, strategy, from)
+	if err != nil {
+		return nil, err
+	}
+	type modelKey struct {
+		model  string
+		series Series
+	}
+	scores := map[modelKey]map[int64]float64{}
+	keys := []modelKey{}
+	for _, p := range dataPoints {
+		if !inRange(p.ReportTime) {
+			continue
+		}
+		key := modelKey{p.Scorer, Series(p.Series)}
+		if _, ok := scores[key]; !ok {
+			scores[key] = map[int64]float64{}
+			keys = append(keys, key)
+		}
+		scores[key][p.ReportTime] = p.Score
+	}
+	growthOf := map[Series]map[int64]float64{}
+	for _, key := range keys {
+		if _, ok := growthOf[key.series]; !ok {
+			growthOf[key.series] = realizedGrowth(daily, key.series, horizon)
+		}
+		days, predicted, realized := []int64{}, []float64{}, []float64{}
+		for day, score := range scores[key] {
+			growth, ok := growthOf[key.series][day]
+			if !ok {
+				continue
+			}
+			days = append(days, day)
+			predicted = append(predicted, score)
+			realized = append(realized, growth)
+		}
+		if rho := spearman(predicted, realized); len(days) >= minBacktestDays && !math.IsNaN(rho) {
+			sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+			metrics = append(metrics, metric(key.model, key.series, MetricSpearman, rho, days))
+		}
+	}
+
+	// forecast
+	growth := realizedGrowth(daily, SeriesCases, horizon)
+	cumulative := map[int64]float64{}
+	records, err := store.Query(loc, from, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		if r.Name == name {
+			cumulative[r.ReportTime] = r.Cases
+		}
+	}
+	days, predicted, realized := []int64{}, []float64{}, []float64{}
+	errorDays, absErrors, covered := []int64{}, 0.0, 0
+	for i, d := range daily {
+		reported, ok := cumulative[d.ReportTime]
+		if !inRange(d.ReportTime) || !ok { // no report on the day
+			continue
+		}
+		// corrections are cleaned within the training window, like ForecastLocation on the day
+		start := i + 1 - windowSize
+		if start < 0 {
+			start = 0
+		}
+		forecasts, err := forecastOf(loc, entry.Level, cleanCorrections(raw[start:i+1], strategy), reported, horizon)
+		if err != nil { // not enough training days
+			continue
+		}
+		if g, ok := growth[d.ReportTime]; ok {
+			future := 0.0
+			for _, f := range forecasts {
+				future += f.Daily
+			}
+			days = append(days, d.ReportTime)
+			predicted = append(predicted, math.Log(future+1)-math.Log(pastSum(daily, dayIndex[d.ReportTime], horizon)+1))
+			realized = append(realized, g)
+		}
+		last := forecasts[len(forecasts)-1]
+		if actual, ok := cumulative[last.TargetTime]; ok {
+			errorDays = append(errorDays, d.ReportTime)
+			absErrors += math.Abs(last.Cases - actual)
+			if last.CasesLower <= actual && actual <= last.CasesUpper {
+				covered++
+			}
+		}
+	}
+	if rho := spearman(predicted, realized); len(days) >= minBacktestDays && !math.IsNaN(rho) {
+		metrics = append(metrics, metric(ModelLogLinear, SeriesCases, MetricSpearman, rho, days))
+	}
+	if len(errorDays) > 0 {
+		metrics = append(metrics,
+			metric(ModelLogLinear, SeriesCases, MetricMAE, absErrors/float64(len(errorDays)), errorDays),
+			metric(ModelLogLinear, SeriesCases, MetricCoverage, float64(covered)/float64(len(errorDays)), errorDays))
+	}
+	sort.SliceStable(metrics, func(i, j int) bool {
+		if metrics[i].Model != metrics[j].Model {
+			return metrics[i].Model < metrics[j].Model
+		}
+		return metrics[i].Series < metrics[j].Series
+	})
+	return metrics, nil
+}
+
+// CDSBacktest backtests every location of level in the collection of loc between the dates from and to, which are optional,
+// and exports the metrics of all locations in format to out.
+// When out is empty, the file is named by the location, ie. data/United States-California-backtest.csv.
+// A location which fails is skipped like in analysisAll.
+func CDSBacktest(store Store, loc PoliticalGeo, level string, scorers []Scorer, windowSize int, policy GapPolicy, strategy CorrectionStrategy, horizon int, from string, to string, format string, out string) error {
+	log.Println("CDSBacktest:", " country:", loc.Country, " state:", loc.State, " county:", loc.County, " horizon:", horizon, " from:", from, " to:", to)
+	if horizon < 1 {
+		return fmt.Errorf("invalid backtest horizon %d", horizon)
+	}
+	fromTime, toTime, err := parseDateRange(from, to)
+	if err != nil {
+		return err
+	}
+	locations, err := LocationsOfLevel(store, loc, level)
+	if err != nil {
+		return err
+	}
+	metrics := []BacktestMetric{}
+	failed := []LocationError{}
+	for _, l := range locations {
+		m, err := BacktestLocation(store, l, scorers, windowSize, policy, strategy, horizon, fromTime, toTime)
+		if err != nil {
+			log.Println("backtest of", l, "error:", err)
+			failed = append(failed, LocationError{Location: l, Err: err})
+			continue
+		}
+		metrics = append(metrics, m...)
+	}
+	written, err := ExportTable(BacktestTable(metrics), format, out, locationName(loc)+"-backtest")
+	if err != nil {
+		return err
+	}
+	log.Println("write", len(metrics), "metrics of", len(locations)-len(failed), "locations to", written)
+	if len(failed) > 0 {
+		return &AnalysisAllError{Total: len(locations), Failed: failed}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestRealizedGrowth(t *testing.T) {
+	growth := realizedGrowth(newCases(1, 1, 1, 3, 3, 3, 9), SeriesCases, 3)
+	if len(growth) != 2 {
+		t.Fatalf("growth %v, want 2 days with 3 days before and after", growth)
+	}
+	if want := math.Log(10) - math.Log(4); !almostEqual(growth[2*secondsOfDay], want) {
+		t.Errorf("growth of day 2 %v, want %v", growth[2*secondsOfDay], want)
+	}
+}
+
+func TestBacktestAsOf(t *testing.T) {
+	loc := PoliticalGeo{Country: CdsIceland}
+	full := NewMemoryStore()
+	if err := CDSHistoryToDB(full, path.Join("testdata", "timeseries-byLocation.json"), loc, 0); err != nil {
+		t.Fatal(err)
+	}
+	asOf, _ := convertDateToUTCTime("2020-04-12")
+	records, _ := full.Query(loc, 0, asOf)
+	truncated := NewMemoryStore()
+	truncated.Upsert("ConfirmIceland", records)
+
+	// forecasts and scores of a day are the same without the records after it
+	want, err := ForecastLocation(truncated, loc, 7, 3, CorrectionClamp, asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ForecastLocation(full, loc, 7, 3, CorrectionClamp, asOf)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("forecast %+v with later records, want %+v", got[i], want[i])
+		}
+	}
+	scorers, _ := NewScorers(ScorerExponential+","+ScorerGrowthRatio, 7, defaultDecay)
+	wantPoints, _ := ScoreSeries(truncated, loc, scorers, 7, GapReport, CorrectionClamp, asOf)
+	gotPoints, _ := ScoreSeries(full, loc, scorers, 7, GapReport, CorrectionClamp, asOf)
+	scores := map[string]float64{}
+	for _, p := range wantPoints {
+		scores[p.ReportDate+p.Scorer] = p.Score
+	}
+	for _, p := range gotPoints {
+		if want, ok := scores[p.ReportDate+p.Scorer]; ok && want != p.Score {
+			t.Errorf("score %s %s %v with later records, want %v", p.ReportDate, p.Scorer, p.Score, want)
+		}
+	}
+}
+
+func TestBacktestLocation(t *testing.T) {
+	store := NewMemoryStore()
+	loc := PoliticalGeo{Country: CdsIceland}
+	if err := CDSHistoryToDB(store, path.Join("testdata", "timeseries-byLocation.json"), loc, 0); err != nil {
+		t.Fatal(err)
+	}
+	scorers, _ := NewScorers(ScorerExponential+","+ScorerMovingAverage, 7, defaultDecay)
+	casesScorers, _ := ForSeries(scorers, []Series{SeriesCases})
+	metrics, err := BacktestLocation(store, loc, casesScorers, 7, GapReport, CorrectionClamp, 3, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]BacktestMetric{}
+	for _, m := range metrics {
+		found[m.Model+"/"+m.Metric] = m
+		if m.Days < 1 || m.Name != CdsIceland || m.Level != "country" || m.Series != string(SeriesCases) {
+			t.Errorf("metric %+v", m)
+		}
+		if MetricSpearman == m.Metric && (m.Value < -1 || m.Value > 1) || MetricCoverage == m.Metric && (m.Value < 0 || m.Value > 1) {
+			t.Errorf("metric %+v out of range", m)
+		}
+	}
+	for _, key := range []string{"exponential/spearman", "movingAverage/spearman", "logLinear/spearman", "logLinear/mae", "logLinear/coverage"} {
+		if _, ok := found[key]; !ok {
+			t.Errorf("no metric %s in %+v", key, metrics)
+		}
+	}
+	// the last 3 days have no future growth
+	if m := found["exponential/spearman"]; m.To != "2020-04-17" {
+		t.Errorf("metric %+v, want days to 2020-04-17", m)
+	}
+
+	from, _ := convertDateToUTCTime("2020-04-08")
+	to, _ := convertDateToUTCTime("2020-04-12")
+	metrics, _ = BacktestLocation(store, loc, scorers, 7, GapReport, CorrectionClamp, 3, from, to)
+	for _, m := range metrics {
+		if m.From < "2020-04-08" || m.To > "2020-04-12" || m.Days > 5 {
+			t.Errorf("metric %+v, want days from 2020-04-08 to 2020-04-12", m)
+		}
+	}
+}
+
+func TestBacktestForecastOfHistory(t *testing.T) {
+	store := NewMemoryStore()
+	loc := PoliticalGeo{Country: CdsIceland}
+	if err := CDSHistoryToDB(store, path.Join("testdata", "timeseries-byLocation.json"), loc, 0); err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := BacktestLocation(store, loc, nil, 7, GapReport, CorrectionClamp, 3, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// forecasts fitted on the history read once are the forecasts of each day
+	records, _ := store.Query(loc, 0, 0)
+	cumulative := map[int64]float64{}
+	for _, r := range records {
+		cumulative[r.ReportTime] = r.Cases
+	}
+	absErrors, days := 0.0, 0
+	for _, r := range records {
+		forecasts, err := ForecastLocation(store, loc, 7, 3, CorrectionClamp, r.ReportTime)
+		if err != nil {
+			continue
+		}
+		last := forecasts[len(forecasts)-1]
+		if actual, ok := cumulative[last.TargetTime]; ok {
+			absErrors += math.Abs(last.Cases - actual)
+			days++
+		}
+	}
+	if 0 == days {
+		t.Fatal("no forecast to evaluate")
+	}
+	for _, m := range metrics {
+		if MetricMAE == m.Metric && (m.Days != days || !almostEqual(m.Value, absErrors/float64(days))) {
+			t.Errorf("metric %+v, want mae %v of %d days", m, absErrors/float64(days), days)
+		}
+	}
+}
+
+func TestCDSBacktest(t *testing.T) {
+	dir := useDataDir(t)
+	store := NewMemoryStore()
+	loc := PoliticalGeo{Country: CdsIceland}
+	if err := CDSHistoryToDB(store, path.Join("testdata", "timeseries-byLocation.json"), loc, 0); err != nil {
+		t.Fatal(err)
+	}
+	scorers, _ := NewScorers(defaultScorers, 7, defaultDecay)
+	if err := CDSBacktest(store, loc, "", scorers, 7, GapReport, CorrectionClamp, 3, "", "", FormatCSV, ""); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path.Join(dir, "Iceland-backtest.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "name,country,state,county,level,model,series,metric,value,days,from,to\n") {
+		t.Errorf("backtest output %s", data)
+	}
+	if err := CDSBacktest(store, loc, "", scorers, 7, GapReport, CorrectionClamp, 0, "", "", FormatCSV, ""); err == nil {
+		t.Error("expect error of horizon 0")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bitmark-inc/autonomy-api/schema"
+)
+
+// CDSLocation is a location of CDS files. timeseries-byLocation.json carries its counts in Dates.
+type CDSLocation struct {
+	Name        string               `json:"name"`
+	City        string               `json:"city"`
+	County      string               `json:"county"`
+	State       string               `json:"state"`
+	Country     string               `json:"country"`
+	CountryID   string               `json:"countryId"`
+	StateID     string               `json:"stateId"`
+	CountyID    string               `json:"countyId"`
+	Level       string               `json:"level"`
+	Coordinates []float64            `json:"coordinates"`
+	Timezone    []string             `json:"tz"`
+	Population  float64              `json:"population"`
+	Dates       map[string]CDSCounts `json:"dates"`
+}
+
+// CDSCounts is counts of a location on a date. A nil count is not reported by CDS.
+type CDSCounts struct {
+	Cases     *float64 `json:"cases"`
+	Deaths    *float64 `json:"deaths"`
+	Recovered *float64 `json:"recovered"`
+	Active    *float64 `json:"active"`
+}
+
+// CDSDailyLocation is an entry of data.json, a location with its latest counts
+type CDSDailyLocation struct {
+	CDSLocation
+	CDSCounts
+}
+
+// LocationFilter selects CDS locations by their structured country, state and county fields.
+// State and County are optional.
+type LocationFilter struct {
+	Country   string
+	CountryID string
+	State     string
+	County    string
+}
+
+// Match reports whether loc is exactly one of the locations of the filter.
+// The country is matched by countryId when both sides have one, otherwise by country name.
+func (f LocationFilter) Match(loc CDSLocation) bool {
+	if "" != f.CountryID && "" != loc.CountryID {
+		if f.CountryID != loc.CountryID {
+			return false
+		}
+	} else if f.Country != loc.Country {
+		return false
+	}
+	if "" != f.State && f.State != loc.State {
+		return false
+	}
+	if "" != f.County && f.County != loc.County {
+		return false
+	}
+	return true
+}
+
+// newCDSRecord builds the record of a location on date. level is the level the parser wants,
+// which is used when the location does not carry one.
+func newCDSRecord(loc CDSLocation, counts CDSCounts, level string, date string) (CDSData, error) {
+	record := CDSData{
+		Name:       loc.Name,
+		City:       loc.City,
+		County:     loc.County,
+		State:      loc.State,
+		Country:    loc.Country,
+		CountryID:  loc.CountryID,
+		StateID:    loc.StateID,
+		CountyID:   loc.CountyID,
+		Level:      loc.Level,
+		Location:   schema.GeoJSON{Type: "Point", Coordinates: []float64{}},
+		Timezone:   []string{},
+		Population: loc.Population,
+	}
+	if len(record.Name) <= 0 {
+		return record, fmt.Errorf("invalid name: %s", record.Name)
+	}
+	if len(record.Country) <= 0 {
+		return record, fmt.Errorf("invalid country: %s", record.Country)
+	}
+	if "" == record.Level {
+		record.Level = inferLevel(loc, level)
+	}
+	if record.Level != level {
+		return record, fmt.Errorf("mismatch level: %s/%s", record.Level, level)
+	}
+	if len(loc.Coordinates) > 0 {
+		record.Location.Coordinates = loc.Coordinates
+	}
+	if len(loc.Timezone) > 0 {
+		record.Timezone = loc.Timezone
+	}
+
+	if nil == counts.Cases {
+		return record, fmt.Errorf("%s has no cases on %s", record.Name, date)
+	}
+	record.Cases = *counts.Cases
+	if counts.Deaths != nil && *counts.Deaths > 0 {
+		record.Deaths = *counts.Deaths
+	}
+	if counts.Recovered != nil && *counts.Recovered > 0 {
+		record.Recovered = *counts.Recovered
+	}
+	if counts.Active != nil {
+		record.Active = *counts.Active
+	}
+	if record.Active <= 0 {
+		record.Active = record.Cases - record.Deaths - record.Recovered
+	}
+
+	reportTime, err := convertDateToUTCTime(date)
+	if err != nil {
+		return record, fmt.Errorf("convert date string to UTC time error: %v", err)
+	}
+	record.ReportTime = reportTime
+	record.UpdateTime = time.Now().UTC().Unix()
+	record.ReportTimeDate = date
+	return record, nil
+}
+
+// inferLevel returns level if the location is at that level, otherwise an empty level
+func inferLevel(loc CDSLocation, level string) string {
+	switch level {
+	case "country":
+		if "" != loc.Country && "" == loc.State {
+			return "country"
+		}
+	case "state":
+		if "" != loc.State && "" == loc.County {
+			return "state"
+		}
+	case "county":
+		if "" != loc.County && "" == loc.City {
+			return "county"
+		}
+	case "city":
+		return "city"
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLocationFilterMatch(t *testing.T) {
+	us := LocationFilter{Country: "United States", CountryID: "iso1:US"}
+	cases := []struct {
+		name   string
+		filter LocationFilter
+		loc    CDSLocation
+		match  bool
+	}{
+		{"country id", us, CDSLocation{Country: "USA", CountryID: "iso1:US"}, true},
+		{"country name without id", us, CDSLocation{Country: "United States"}, true},
+		{"name contains country", LocationFilter{Country: "Taiwan"}, CDSLocation{Name: "Taiwanese Community, Ontario, Canada", Country: "Canada"}, false},
+		{"other country id", us, CDSLocation{Country: "United States", CountryID: "iso1:CA"}, false},
+		{"state", LocationFilter{Country: "United States", State: "California"}, CDSLocation{Country: "United States", State: "Washington"}, false},
+		{"county", LocationFilter{Country: "United States", State: "California", County: "Alameda County"}, CDSLocation{Country: "United States", State: "California", County: "Alameda County"}, true},
+	}
+	for _, c := range cases {
+		if match := c.filter.Match(c.loc); match != c.match {
+			t.Errorf("%s: match %v, want %v", c.name, match, c.match)
+		}
+	}
+}
+
+func TestNewCDSRecord(t *testing.T) {
+	cases := float64(10)
+	deaths := float64(-1)
+	loc := CDSLocation{Name: "Alameda County, California, United States", County: "Alameda County", State: "California", Country: "United States"}
+
+	record, err := newCDSRecord(loc, CDSCounts{Cases: &cases, Deaths: &deaths}, "county", "2020-04-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Level != "county" {
+		t.Errorf("level %s, want county inferred", record.Level)
+	}
+	if record.Deaths != 0 || record.Active != 10 {
+		t.Errorf("deaths %f active %f, want 0 and 10", record.Deaths, record.Active)
+	}
+	if record.Location.Type != "Point" || record.Timezone == nil {
+		t.Errorf("location %+v timezone %v, want empty point and timezone", record.Location, record.Timezone)
+	}
+
+	if _, err := newCDSRecord(loc, CDSCounts{Cases: &cases}, "state", "2020-04-01"); err == nil {
+		t.Error("expect level mismatch error")
+	}
+	if _, err := newCDSRecord(loc, CDSCounts{}, "county", "2020-04-01"); err == nil {
+		t.Error("expect no cases error")
+	}
+	if _, err := newCDSRecord(loc, CDSCounts{Cases: &cases}, "county", "2020/04/01"); err == nil {
+		t.Error("expect date error")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// CorrectionStrategy decides how a cumulative count which is revised downward is cleaned.
+// A downward revision shows as a negative daily delta.
+type CorrectionStrategy string
+
+const (
+	CorrectionNone CorrectionStrategy = "none"
+	// CorrectionClamp sets a negative delta to zero
+	CorrectionClamp CorrectionStrategy = "clamp"
+	// CorrectionDistribute sets a negative delta to zero and subtracts it from earlier days in proportion to their deltas
+	CorrectionDistribute CorrectionStrategy = "distribute"
+	// CorrectionDrop removes the point with a negative delta
+	CorrectionDrop CorrectionStrategy = "drop"
+)
+
+func ParseCorrectionStrategy(strategy string) (CorrectionStrategy, error) {
+	switch CorrectionStrategy(strategy) {
+	case CorrectionNone, CorrectionClamp, CorrectionDistribute, CorrectionDrop:
+		return CorrectionStrategy(strategy), nil
+	default:
+		return "", fmt.Errorf("unknown correction strategy %s", strategy)
+	}
+}
+
+// cleanCorrections removes negative daily deltas of cases, deaths and recovered sorted by report_ts in ascending order, and logs each correction.
+// Only cases and deaths decide the days CorrectionDrop removes, and negative recovered of the other days is clamped.
+// The daily change of active cases is not cleaned, as it goes down when patients recover. data is not modified.
+func cleanCorrections(data []CDSScoreDataSet, strategy CorrectionStrategy) []CDSScoreDataSet {
+	if CorrectionNone == strategy {
+		return data
+	}
+	cleaned := make([]CDSScoreDataSet, 0, len(data))
+	for _, d := range data {
+		if CorrectionDrop == strategy && (d.Cases < 0 || d.Deaths < 0) {
+			log.Println("correction drop:", d.Name, d.ReportDate, "cases:", d.Cases, "deaths:", d.Deaths)
+			continue
+		}
+		cleaned = append(cleaned, d)
+	}
+	if CorrectionDrop == strategy {
+		correct(cleaned, "recovered", CorrectionClamp, func(d *CDSScoreDataSet) *float64 { return &d.Recovered })
+		return cleaned
+	}
+	correct(cleaned, "cases", strategy, func(d *CDSScoreDataSet) *float64 { return &d.Cases })
+	correct(cleaned, "deaths", strategy, func(d *CDSScoreDataSet) *float64 { return &d.Deaths })
+	correct(cleaned, "recovered", strategy, func(d *CDSScoreDataSet) *float64 { return &d.Recovered })
+	return cleaned
+}
+
+// correct clamps or back-distributes negative values of a field of data
+func correct(data []CDSScoreDataSet, field string, strategy CorrectionStrategy, value func(*CDSScoreDataSet) *float64) {
+	for i := range data {
+		v := value(&data[i])
+		if *v >= 0 {
+			continue
+		}
+		correction := -*v
+		*v = 0
+		if CorrectionClamp == strategy {
+			log.Println("correction clamp:", data[i].Name, data[i].ReportDate, field, -correction, "to 0")
+			continue
+		}
+		earlier := float64(0)
+		for j := 0; j < i; j++ {
+			earlier += *value(&data[j])
+		}
+		if earlier <= 0 {
+			log.Println("correction distribute:", data[i].Name, data[i].ReportDate, field, -correction, "has no earlier", field, "and is clamped to 0")
+			continue
+		}
+		ratio := correction / earlier
+		if ratio > 1 {
+			log.Println("correction distribute:", data[i].Name, data[i].ReportDate, field, -correction, "is larger than earlier", field, earlier, "of the window")
+			ratio = 1
+		}
+		for j := 0; j < i; j++ {
+			ev := value(&data[j])
+			*ev -= *ev * ratio
+		}
+		log.Println("correction distribute:", data[i].Name, data[i].ReportDate, field, -correction, "to", i, "earlier days")
+	}
+}
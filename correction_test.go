@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCleanCorrections(t *testing.T) {
+	data := newCases(4, 6, 10, -5, 3)
+	data[1].Deaths = -1
+
+	cases := []struct {
+		strategy CorrectionStrategy
+		cases    []float64
+		deaths   []float64
+	}{
+		{CorrectionNone, []float64{4, 6, 10, -5, 3}, []float64{0, -1, 0, 0, 0}},
+		{CorrectionClamp, []float64{4, 6, 10, 0, 3}, []float64{0, 0, 0, 0, 0}},
+		{CorrectionDistribute, []float64{3, 4.5, 7.5, 0, 3}, []float64{0, 0, 0, 0, 0}},
+		{CorrectionDrop, []float64{4, 10, 3}, []float64{0, 0, 0}},
+	}
+	for _, c := range cases {
+		cleaned := cleanCorrections(data, c.strategy)
+		if len(cleaned) != len(c.cases) {
+			t.Errorf("%s: cleaned %+v, want %v", c.strategy, cleaned, c.cases)
+			continue
+		}
+		for i, d := range cleaned {
+			if !almostEqual(d.Cases, c.cases[i]) || !almostEqual(d.Deaths, c.deaths[i]) {
+				t.Errorf("%s: day %d cases %f deaths %f, want %f %f", c.strategy, i, d.Cases, d.Deaths, c.cases[i], c.deaths[i])
+			}
+		}
+	}
+	if data[3].Cases != -5 || data[1].Deaths != -1 {
+		t.Error("input data is modified")
+	}
+}
+
+func TestCleanCorrectionsLargerThanWindow(t *testing.T) {
+	cleaned := cleanCorrections(newCases(1, 2, -10, 4), CorrectionDistribute)
+	want := []float64{0, 0, 0, 4}
+	for i, d := range cleaned {
+		if d.Cases != want[i] {
+			t.Errorf("day %d cases %f, want %f", i, d.Cases, want[i])
+		}
+	}
+}
+
+func TestCleanCorrectionsRecoveredAndActive(t *testing.T) {
+	data := newCases(4, 6, 10)
+	data[1].Recovered = -2
+	data[1].Active = -7
+	for _, strategy := range []CorrectionStrategy{CorrectionClamp, CorrectionDrop} {
+		cleaned := cleanCorrections(data, strategy)
+		if len(cleaned) != 3 {
+			t.Fatalf("%s: cleaned %+v, want 3 days", strategy, cleaned)
+		}
+		if cleaned[1].Recovered != 0 {
+			t.Errorf("%s: recovered %f, want 0", strategy, cleaned[1].Recovered)
+		}
+		if cleaned[1].Active != -7 {
+			t.Errorf("%s: daily change of active %f, want -7 kept", strategy, cleaned[1].Active)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// CDSCountry describes how one country of CDS data is ingested and scored
+type CDSCountry struct {
+	Country    string   `json:"country" mapstructure:"country"`       // name used by -country
+	Match      string   `json:"match" mapstructure:"match"`           // CDS country name
+	CountryID  string   `json:"countryId" mapstructure:"countryId"`   // CDS countryId, ie. iso1:US
+	Level      string   `json:"level" mapstructure:"level"`           // target level
+	Collection string   `json:"collection" mapstructure:"collection"` // db collection
+	FilterKeys []string `json:"filterKeys" mapstructure:"filterKeys"` // analysis filter keys: state / county
+}
+
+type CDSCountryRegistry map[string]CDSCountry
+
+var ErrCountryNotRegistered = fmt.Errorf("country is not registered")
+
+var defaultCDSCountries = []CDSCountry{
+	{Country: CdsUSA, Match: "United States", CountryID: "iso1:US", Level: "county", Collection: "ConfirmUS", FilterKeys: []string{"state", "county"}},
+	{Country: CdsTaiwan, Match: "Taiwan", CountryID: "iso1:TW", Level: "country", Collection: "ConfirmTaiwan", FilterKeys: []string{}},
+	{Country: CdsIceland, Match: "Iceland", CountryID: "iso1:IS", Level: "country", Collection: "ConfirmIceland", FilterKeys: []string{}},
+}
+
+// registry is the country registry used by jobs. It is replaced by LoadCDSCountryRegistry when -countries is given.
+var registry = NewCDSCountryRegistry()
+
+// NewCDSCountryRegistry returns a registry holding the default countries
+func NewCDSCountryRegistry() CDSCountryRegistry {
+	r := CDSCountryRegistry{}
+	for _, c := range defaultCDSCountries {
+		r[c.Country] = c
+	}
+	return r
+}
+
+// LoadCDSCountryRegistry reads countries from a config file (json/yaml/toml) on top of the default countries.
+// The file holds a list under the key "countries". An entry with the same country name replaces the default one.
+func LoadCDSCountryRegistry(file string) (CDSCountryRegistry, error) {
+	r := NewCDSCountryRegistry()
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	countries := []CDSCountry{}
+	if err := v.UnmarshalKey("countries", &countries); err != nil {
+		return nil, err
+	}
+	for _, c := range countries {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+		if "" == c.Match {
+			c.Match = c.Country
+		}
+		r[c.Country] = c
+	}
+	return r, nil
+}
+
+// Lookup returns the registered setting of a country
+func (r CDSCountryRegistry) Lookup(country string) (CDSCountry, error) {
+	c, ok := r[country]
+	if !ok {
+		return CDSCountry{}, ErrCountryNotRegistered
+	}
+	return c, nil
+}
+
+// locationFilter returns the filter of ingest. state and county are optional.
+func (c CDSCountry) locationFilter(state, county string) LocationFilter {
+	return LocationFilter{Country: c.Match, CountryID: c.CountryID, State: state, County: county}
+}
+
+func (c CDSCountry) validate() error {
+	if "" == c.Country || "" == c.Collection {
+		return fmt.Errorf("invalid country setting %+v: country and collection are required", c)
+	}
+	switch c.Level {
+	case "country", "state", "county", "city":
+	default:
+		return fmt.Errorf("invalid country setting %+v: invalid level %s", c, c.Level)
+	}
+	for _, key := range c.FilterKeys {
+		switch key {
+		case "state", "county":
+		default:
+			return fmt.Errorf("invalid country setting %+v: invalid filter key %s", c, key)
+		}
+	}
+	return nil
+}
+
+// filter returns the analysis filter of a location. All filter keys of the country need a value, and the error of a missing one names the key.
+func (c CDSCountry) filter(loc PoliticalGeo) (map[string]string, error) {
+	filter := map[string]string{}
+	for _, key := range c.FilterKeys {
+		value := ""
+		switch key {
+		case "state":
+			value = loc.State
+		case "county":
+			value = loc.County
+		}
+		if "" == value {
+			return nil, fmt.Errorf("%w: %s of %s is required, ie. -%s", ErrNoConfirmDataset, key, c.Country, key)
+		}
+		filter[key] = value
+	}
+	return filter, nil
+}
+
+// queryFilter returns the filter of a query. State and county are optional and narrow the query when given.
+func (c CDSCountry) queryFilter(loc PoliticalGeo) map[string]string {
+	filter := map[string]string{}
+	if "" != loc.State {
+		filter["state"] = loc.State
+	}
+	if "" != loc.County {
+		filter["county"] = loc.County
+	}
+	return filter
+}
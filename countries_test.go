@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestLoadCDSCountryRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "countries.yaml")
+	config := `countries:
+  - country: Germany
+    level: state
+    collection: ConfirmGermany
+    filterKeys: [state]
+  - country: Taiwan
+    match: Taiwan
+    countryId: iso1:TW
+    level: country
+    collection: ConfirmTW
+`
+	if err := ioutil.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := LoadCDSCountryRegistry(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	germany, err := r.Lookup("Germany")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if germany.Match != "Germany" || germany.Collection != "ConfirmGermany" {
+		t.Errorf("germany %+v, want match defaults to country", germany)
+	}
+	if tw, _ := r.Lookup(CdsTaiwan); tw.Collection != "ConfirmTW" {
+		t.Errorf("taiwan collection %s, want ConfirmTW", tw.Collection)
+	}
+	if _, err := r.Lookup(CdsIceland); err != nil {
+		t.Error("default country is missing")
+	}
+	if _, err := r.Lookup("Canada"); err != ErrCountryNotRegistered {
+		t.Errorf("error %v, want ErrCountryNotRegistered", err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("countries:\n  - country: Brazil\n    level: town\n    collection: ConfirmBrazil\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCDSCountryRegistry(file); err == nil {
+		t.Error("expect invalid level error")
+	}
+}
+
+func TestCDSCountryFilter(t *testing.T) {
+	us, _ := registry.Lookup(CdsUSA)
+	if _, err := us.filter(PoliticalGeo{Country: CdsUSA, State: "California"}); !errors.Is(err, ErrNoConfirmDataset) || !strings.Contains(err.Error(), "county") {
+		t.Errorf("error %v, want ErrNoConfirmDataset naming county", err)
+	}
+	filter, err := us.filter(PoliticalGeo{Country: CdsUSA, State: "California", County: "Alameda County"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter["state"] != "California" || filter["county"] != "Alameda County" {
+		t.Errorf("filter %v", filter)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrDownloadStatus = fmt.Errorf("unexpected download response")
+
+// DownloadMeta is kept next to a downloaded file as <file>.meta.json, so the next download of the same URL is conditional
+type DownloadMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchTime    time.Time `json:"fetch_time"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+}
+
+func downloadMetaPath(file string) string {
+	return file + ".meta.json"
+}
+
+// loadDownloadMeta returns the meta of file, or nil when the file or its meta is missing
+func loadDownloadMeta(file string) *DownloadMeta {
+	if _, err := os.Stat(file); err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(downloadMetaPath(file))
+	if err != nil {
+		return nil
+	}
+	meta := DownloadMeta{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil
+	}
+	return &meta
+}
+
+func saveDownloadMeta(file string, meta DownloadMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := downloadMetaPath(file) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, downloadMetaPath(file))
+}
+
+// CDSDownload downloads url to the data file of source. The request is conditional on the ETag and Last-Modified of the previous download,
+// and the file is left untouched when upstream has not changed or the response is not the data file.
+func CDSDownload(url string, source CovidSource) error {
+	file, err := getDataFilePath(source)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	header := http.Header{}
+	meta := loadDownloadMeta(file)
+	conditional := meta != nil && meta.URL == url
+	if conditional {
+		if meta.ETag != "" {
+			header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := NewFetcher(httpDownloadMaxByte, downloadMaxByteKey).Get(url, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		if !conditional { // nothing to compare with, ie. a proxy answers 304 anyway
+			return fmt.Errorf("%w: %s %s without a conditional request", ErrDownloadStatus, url, resp.Status)
+		}
+		log.Println("download:", url, "not modified since", meta.FetchTime.Format(time.RFC3339), ", skip")
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s %s", ErrDownloadStatus, url, resp.Status)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "text/html" {
+		return fmt.Errorf("%w: %s returns %s", ErrDownloadStatus, url, mediaType)
+	}
+
+	// write to a temp file in the same directory, so the rename is atomic
+	out, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), resp.Body)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(out.Name(), file); err != nil {
+		return err
+	}
+	log.Println("download:", url, "to", file, "size:", size)
+	return saveDownloadMeta(file, DownloadMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchTime:    time.Now().UTC(),
+		Size:         size,
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+)
+
+func TestCDSDownloadConditional(t *testing.T) {
+	dir := useDataDir(t)
+	data, _ := ioutil.ReadFile(path.Join("testdata", "dataDaily.json"))
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fetches++
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := CDSDownload(server.URL, CDSDaily); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("fetches %d, want 1", fetches)
+	}
+	file := path.Join(dir, "dataDaily.json")
+	meta := loadDownloadMeta(file)
+	if meta == nil {
+		t.Fatal("no download meta")
+	}
+	if meta.URL != server.URL || meta.ETag != `"v1"` || meta.Size != int64(len(data)) || len(meta.SHA256) != 64 {
+		t.Errorf("meta %+v", meta)
+	}
+}
+
+func TestCDSDownloadBadResponse(t *testing.T) {
+	dir := useDataDir(t)
+	file := path.Join(dir, "dataDaily.json")
+	ioutil.WriteFile(file, []byte("[]"), 0644)
+	cases := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"not found", func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) }},
+		{"html page", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html>maintenance</html>"))
+		}},
+		{"not modified without a previous download", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotModified) }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := httptest.NewServer(c.handler)
+			defer server.Close()
+			if err := CDSDownload(server.URL, CDSDaily); !errors.Is(err, ErrDownloadStatus) {
+				t.Errorf("error %v, want ErrDownloadStatus", err)
+			}
+			if data, _ := ioutil.ReadFile(file); string(data) != "[]" {
+				t.Errorf("file is overwritten by %s", data)
+			}
+		})
+	}
+}
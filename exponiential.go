@@ -4,32 +4,41 @@ import (
 	"math"
 )
 
+// Exponiential weights daily new cases of the window by exp((idx+1)*Decay), so recent days weigh more
 type Exponiential struct {
-	OutputDataPoint []CDSDataPoint
+	WindowSize int
+	Decay      float64
 }
 
-func (e *Exponiential) Score(loc PoliticalGeo, data []CDSScoreDataSet) {
-	score, name, reportTime, reportDate := e.calculateScore(data)
-	if len(data) > 0 {
-		dataPoint := CDSDataPoint{Name: name, ReportTime: reportTime, ReportDate: reportDate, Score: score, Country: loc.Country, State: loc.State, County: loc.County}
-		e.OutputDataPoint = append(e.OutputDataPoint, dataPoint)
-	}
-	return
+func (e Exponiential) Name() string {
+	return ScorerExponential
+}
 
+func (e Exponiential) Score(data []CDSScoreDataSet) float64 {
+	score, _, _, _ := e.calculateScore(data)
+	return score
 }
 
-func (e *Exponiential) calculateScore(dataset []CDSScoreDataSet) (float64, string, int64, string) {
+func (e Exponiential) calculateScore(dataset []CDSScoreDataSet) (float64, string, int64, string) {
 	score := float64(0)
+	windowSize := e.WindowSize
+	if windowSize <= 0 {
+		windowSize = defaultWindowSize
+	}
+	decay := e.Decay
+	if decay <= 0 {
+		decay = defaultDecay
+	}
 	sizeOfConfirmData := len(dataset)
 	reportTime := int64(0)
 	reportDate := ""
 	if 0 == len(dataset) {
 		return 0, "", reportTime, reportDate
-	} else if len(dataset) < defaultWindowSize {
+	} else if len(dataset) < windowSize {
 		reportTime = dataset[sizeOfConfirmData-1].ReportTime
 		reportDate = dataset[sizeOfConfirmData-1].ReportDate
 		zeroDay := []CDSScoreDataSet{CDSScoreDataSet{Name: dataset[0].Name, Cases: 0}}
-		for idx := 0; idx < defaultWindowSize-sizeOfConfirmData; idx++ {
+		for idx := 0; idx < windowSize-sizeOfConfirmData; idx++ {
 			dataset = append(zeroDay, dataset...)
 		}
 	} else {
@@ -41,7 +50,7 @@ func (e *Exponiential) calculateScore(dataset []CDSScoreDataSet) (float64, strin
 	numerator := float64(0)
 	denominator := float64(0)
 	for idx, val := range dataset {
-		power := (float64(idx) + 1) / 2
+		power := (float64(idx) + 1) * decay
 		numerator = numerator + math.Exp(power)*val.Cases
 		denominator = denominator + math.Exp(power)*(val.Cases+1)
 	}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	FormatCSV     = "csv"
+	FormatJSON    = "json"
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+	// outStdout is the -out value which writes to stdout
+	outStdout = "-"
+	// parquetParallel is the number of goroutines which marshal a parquet row group
+	parquetParallel = 4
+)
+
+type columnKind int
+
+const (
+	stringColumn columnKind = iota
+	intColumn
+	floatColumn
+)
+
+type Column struct {
+	Name string
+	Kind columnKind
+}
+
+// Table is rows of values with named and typed columns, so every format writes the same columns in the same order.
+// A value is a string, an int64 or a float64 by the kind of its column.
+type Table struct {
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+var dataPointColumns = []Column{
+	{"name", stringColumn},
+	{"date", stringColumn},
+	{"timestamp", intColumn},
+	{"score", floatColumn},
+	{"scorer", stringColumn},
+	{"series", stringColumn},
+	{"population", intColumn},
+	{"cases_per_100k_7d", floatColumn},
+	{"cases_per_100k_14d", floatColumn},
+	{"deaths_per_100k_14d", floatColumn},
+	{"gap_points", intColumn},
+	{"country", stringColumn},
+	{"state", stringColumn},
+	{"county", stringColumn},
+	{"level", stringColumn},
+}
+
+// DataPointTable converts analysis data points to a table
+func DataPointTable(data []CDSDataPoint) Table {
+	t := Table{Columns: dataPointColumns}
+	for _, p := range data {
+		t.Rows = append(t.Rows, []interface{}{
+			p.Name,
+			p.ReportDate,
+			p.ReportTime,
+			p.Score,
+			p.Scorer,
+			p.Series,
+			int64(p.Population),
+			p.CasesPer100k7,
+			p.CasesPer100k14,
+			p.DeathsPer100k,
+			int64(p.GapPoints),
+			p.Country,
+			p.State,
+			p.County,
+			p.Level,
+		})
+	}
+	return t
+}
+
+var rtColumns = []Column{
+	{"name", stringColumn},
+	{"date", stringColumn},
+	{"timestamp", intColumn},
+	{"rt_mean", floatColumn},
+	{"rt_lower", floatColumn},
+	{"rt_upper", floatColumn},
+	{"cases", floatColumn},
+	{"gap_points", intColumn},
+	{"country", stringColumn},
+	{"state", stringColumn},
+	{"county", stringColumn},
+	{"level", stringColumn},
+}
+
+// RtTable converts Rt estimates to a table with the location and date columns of DataPointTable
+func RtTable(estimates []RtEstimate) Table {
+	t := Table{Columns: rtColumns}
+	for _, e := range estimates {
+		t.Rows = append(t.Rows, []interface{}{
+			e.Name,
+			e.ReportDate,
+			e.ReportTime,
+			e.Mean,
+			e.Lower,
+			e.Upper,
+			e.Cases,
+			int64(e.GapPoints),
+			e.Country,
+			e.State,
+			e.County,
+			e.Level,
+		})
+	}
+	return t
+}
+
+var backtestColumns = []Column{
+	{"name", stringColumn},
+	{"country", stringColumn},
+	{"state", stringColumn},
+	{"county", stringColumn},
+	{"level", stringColumn},
+	{"model", stringColumn},
+	{"series", stringColumn},
+	{"metric", stringColumn},
+	{"value", floatColumn},
+	{"days", intColumn},
+	{"from", stringColumn},
+	{"to", stringColumn},
+}
+
+// BacktestTable converts backtest metrics to a table
+func BacktestTable(metrics []BacktestMetric) Table {
+	t := Table{Columns: backtestColumns}
+	for _, m := range metrics {
+		t.Rows = append(t.Rows, []interface{}{
+			m.Name,
+			m.Country,
+			m.State,
+			m.County,
+			m.Level,
+			m.Model,
+			m.Series,
+			m.Metric,
+			m.Value,
+			int64(m.Days),
+			m.From,
+			m.To,
+		})
+	}
+	return t
+}
+
+var recordColumns = []Column{
+	{"name", stringColumn},
+	{"city", stringColumn},
+	{"county", stringColumn},
+	{"state", stringColumn},
+	{"country", stringColumn},
+	{"level", stringColumn},
+	{"cases", floatColumn},
+	{"deaths", floatColumn},
+	{"recovered", floatColumn},
+	{"active", floatColumn},
+	{"report_ts", intColumn},
+	{"update_ts", intColumn},
+	{"report_date", stringColumn},
+	{"countryId", stringColumn},
+	{"stateId", stringColumn},
+	{"countyId", stringColumn},
+	{"longitude", floatColumn},
+	{"latitude", floatColumn},
+	{"tz", stringColumn},
+	{"population", intColumn},
+}
+
+// RecordTable converts CDS records to a table. The location is split into longitude and latitude, which are 0 when it is unknown,
+// and timezones are joined by comma.
+func RecordTable(records []CDSData) Table {
+	t := Table{Columns: recordColumns}
+	for _, r := range records {
+		lon, lat := 0.0, 0.0
+		if len(r.Location.Coordinates) >= 2 {
+			lon, lat = r.Location.Coordinates[0], r.Location.Coordinates[1]
+		}
+		t.Rows = append(t.Rows, []interface{}{
+			r.Name,
+			r.City,
+			r.County,
+			r.State,
+			r.Country,
+			r.Level,
+			r.Cases,
+			r.Deaths,
+			r.Recovered,
+			r.Active,
+			r.ReportTime,
+			r.UpdateTime,
+			r.ReportTimeDate,
+			r.CountryID,
+			r.StateID,
+			r.CountyID,
+			lon,
+			lat,
+			strings.Join(r.Timezone, ","),
+			int64(r.Population),
+		})
+	}
+	return t
+}
+
+func ParseExportFormat(format string) (string, error) {
+	switch format {
+	case FormatCSV, FormatJSON, FormatJSONL, FormatParquet:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown export format %s", format)
+	}
+}
+
+// ExportTable writes t in format to out and returns the path written. out is a file path, or - for stdout.
+// When out is empty, the file is named by name in the data directory, ie. data/Taiwan-2020-04-20.csv.
+func ExportTable(t Table, format string, out string, name string) (string, error) {
+	if outStdout == out {
+		return out, WriteTable(os.Stdout, t, format)
+	}
+	if "" == out {
+		working, err := dataDirPath()
+		if err != nil {
+			return "", err
+		}
+		out = path.Join(working, name+"."+format)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return "", err
+	}
+	if err := WriteTable(f, t, format); err != nil {
+		f.Close()
+		return "", err
+	}
+	return out, f.Close()
+}
+
+// WriteTable writes t in format to w
+func WriteTable(w io.Writer, t Table, format string) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, t)
+	case FormatJSON:
+		return writeJSONRows(w, t, false)
+	case FormatJSONL:
+		return writeJSONRows(w, t, true)
+	case FormatParquet:
+		return writeParquet(w, t)
+	default:
+		return fmt.Errorf("unknown export format %s", format)
+	}
+}
+
+func writeCSV(w io.Writer, t Table) error {
+	cw := csv.NewWriter(w)
+	header := []string{}
+	for _, c := range t.Columns {
+		header = append(header, c.Name)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		record := []string{}
+		for _, value := range row {
+			switch v := value.(type) {
+			case float64:
+				record = append(record, fmt.Sprintf("%f", v))
+			case int64:
+				record = append(record, strconv.FormatInt(v, 10))
+			default:
+				record = append(record, fmt.Sprint(v))
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSONRows writes each row as an object with keys in the column order, as an array or one object per line.
+// A float which is not finite is null.
+func writeJSONRows(w io.Writer, t Table, lines bool) error {
+	bw := bufio.NewWriter(w)
+	if !lines {
+		bw.WriteString("[")
+	}
+	for i, row := range t.Rows {
+		if i > 0 && !lines {
+			bw.WriteString(",\n")
+		}
+		bw.WriteString("{")
+		for j, value := range row {
+			if j > 0 {
+				bw.WriteString(",")
+			}
+			key, _ := json.Marshal(t.Columns[j].Name)
+			if f, ok := value.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+				value = nil // JSON has no infinity, ie. growthRatio after days without a case
+			}
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			bw.Write(key)
+			bw.WriteString(":")
+			bw.Write(data)
+		}
+		bw.WriteString("}")
+		if lines {
+			bw.WriteString("\n")
+		}
+	}
+	if !lines {
+		bw.WriteString("]\n")
+	}
+	return bw.Flush()
+}
+
+func writeParquet(w io.Writer, t Table) error {
+	md := []string{}
+	for _, c := range t.Columns {
+		switch c.Kind {
+		case intColumn:
+			md = append(md, fmt.Sprintf("name=%s, type=INT64", c.Name))
+		case floatColumn:
+			md = append(md, fmt.Sprintf("name=%s, type=DOUBLE", c.Name))
+		default:
+			md = append(md, fmt.Sprintf("name=%s, type=BYTE_ARRAY, convertedtype=UTF8", c.Name))
+		}
+	}
+	pw, err := writer.NewCSVWriterFromWriter(md, w, parquetParallel)
+	if err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		if err := pw.Write(row); err != nil {
+			return err
+		}
+	}
+	return pw.WriteStop()
+}
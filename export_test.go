@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// parquetFile reads a parquet file of the os
+type parquetFile struct {
+	*os.File
+}
+
+func (f parquetFile) Open(name string) (source.ParquetFile, error) {
+	if "" == name {
+		name = f.Name()
+	}
+	file, err := os.Open(name)
+	return parquetFile{file}, err
+}
+
+func (f parquetFile) Create(name string) (source.ParquetFile, error) {
+	file, err := os.Create(name)
+	return parquetFile{file}, err
+}
+
+func testDataPoints() []CDSDataPoint {
+	return []CDSDataPoint{
+		{Name: "Taiwan", ReportTime: 1587340800, ReportDate: "2020-04-20", Score: 0.5, Scorer: ScorerExponential, PerCapita: PerCapita{Population: 23780452, CasesPer100k7: 0.1}, Country: CdsTaiwan, Level: "country"},
+		{Name: "Taiwan", ReportTime: 1587254400, ReportDate: "2020-04-19", Score: 0.25, Scorer: ScorerExponential, PerCapita: PerCapita{Population: 23780452}, GapPoints: 1, Country: CdsTaiwan, Level: "country"},
+	}
+}
+
+func TestWriteTableCSV(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := WriteTable(&buf, DataPointTable(testDataPoints()), FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("rows %d, want header and 2 rows", len(rows))
+	}
+	for _, row := range rows {
+		if len(row) != len(dataPointColumns) {
+			t.Errorf("row %v has %d columns, want %d", row, len(row), len(dataPointColumns))
+		}
+	}
+	if rows[0][14] != "level" || rows[1][14] != "country" {
+		t.Errorf("level column %s: %s", rows[0][14], rows[1][14])
+	}
+}
+
+func TestWriteTableJSON(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatJSONL} {
+		buf := bytes.Buffer{}
+		if err := WriteTable(&buf, DataPointTable(testDataPoints()), format); err != nil {
+			t.Fatal(err)
+		}
+		rows := []map[string]interface{}{}
+		if format == FormatJSON {
+			if err := json.Unmarshal(buf.Bytes(), &rows); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				row := map[string]interface{}{}
+				if err := json.Unmarshal([]byte(line), &row); err != nil {
+					t.Fatal(err)
+				}
+				rows = append(rows, row)
+			}
+		}
+		if len(rows) != 2 {
+			t.Fatalf("%s rows %d, want 2", format, len(rows))
+		}
+		if rows[1]["gap_points"] != 1.0 || rows[1]["date"] != "2020-04-19" || rows[0]["level"] != "country" {
+			t.Errorf("%s row %v", format, rows[1])
+		}
+	}
+	// JSON has no infinity
+	points := testDataPoints()
+	points[0].Score = math.Inf(1)
+	buf := bytes.Buffer{}
+	if err := WriteTable(&buf, DataPointTable(points), FormatJSONL); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"score":null`) {
+		t.Errorf("infinite score %s, want null", buf.String())
+	}
+	if data, err := json.Marshal(points[0]); err != nil || !strings.Contains(string(data), `"score":null`) {
+		t.Errorf("infinite score %s %v, want null", data, err)
+	}
+	buf = bytes.Buffer{}
+	WriteTable(&buf, Table{Columns: dataPointColumns}, FormatJSON)
+	if buf.String() != "[]\n" {
+		t.Errorf("empty json %q", buf.String())
+	}
+}
+
+func TestExportTableParquet(t *testing.T) {
+	dir := useDataDir(t)
+	records := dailySeries(CdsIceland, "2020-04-01", 1, 2, 3)
+	out := path.Join(dir, "records.parquet")
+	written, err := ExportTable(RecordTable(records), FormatParquet, out, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pr, err := reader.NewParquetColumnReader(parquetFile{f}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.ReadStop()
+	if pr.GetNumRows() != 3 {
+		t.Errorf("rows %d, want 3", pr.GetNumRows())
+	}
+	cases, _, _, err := pr.ReadColumnByPath(common.ReformPathStr("parquet_go_root.cases"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 3 || cases[2] != 3.0 {
+		t.Errorf("cases %v, want 1, 2, 3", cases)
+	}
+}
+
+func TestCDSExport(t *testing.T) {
+	dir := useDataDir(t)
+	store := NewMemoryStore()
+	if err := CDSHistoryToDB(store, path.Join("testdata", "timeseries-byLocation.json"), PoliticalGeo{Country: CdsIceland}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := CDSExport(store, PoliticalGeo{Country: CdsIceland}, "2020-04-10", "2020-04-12", FormatJSONL, ""); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path.Join(dir, "Iceland-records.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("lines %d, want 3", lines)
+	}
+	if err := CDSExport(store, PoliticalGeo{Country: CdsIceland}, "April", "", FormatCSV, ""); err == nil {
+		t.Error("expect error of invalid date")
+	}
+}
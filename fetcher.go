@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultHTTPTimeout = 5 * time.Minute
+	defaultHTTPRetries = 3
+	defaultHTTPBackoff = time.Second
+
+	// dailyMaxByteKey is the config key of the byte cap of a response read into memory, ie. the daily file
+	dailyMaxByteKey = "http.dailymaxbyte"
+	// downloadMaxByteKey is the config key of the byte cap of a download streamed to a file
+	downloadMaxByteKey = "http.downloadmaxbyte"
+)
+
+var ErrResponseTooLarge = fmt.Errorf("response is larger than the byte cap")
+
+// Fetcher gets CDS data over HTTP with a per-request timeout, retries with exponential backoff on 5xx and network errors,
+// and a cap of bytes read from a response body.
+// It is configured by env AUTONOMY_HTTP_TIMEOUT, AUTONOMY_HTTP_RETRIES and AUTONOMY_HTTP_BACKOFF.
+type Fetcher struct {
+	Client   *http.Client
+	Retries  int
+	Backoff  time.Duration // wait before the first retry, doubled on each retry
+	MaxBytes int64
+}
+
+// NewFetcher returns a fetcher with the byte cap maxBytes, which the config key maxByteKey overrides.
+// A response read into memory has a smaller cap than a download streamed to a file.
+func NewFetcher(maxBytes int64, maxByteKey string) *Fetcher {
+	f := Fetcher{
+		Client:   &http.Client{Timeout: defaultHTTPTimeout},
+		Retries:  defaultHTTPRetries,
+		Backoff:  defaultHTTPBackoff,
+		MaxBytes: maxBytes,
+	}
+	if viper.IsSet("http.timeout") {
+		f.Client.Timeout = viper.GetDuration("http.timeout")
+	}
+	if viper.IsSet("http.retries") {
+		f.Retries = viper.GetInt("http.retries")
+	}
+	if viper.IsSet("http.backoff") {
+		f.Backoff = viper.GetDuration("http.backoff")
+	}
+	if viper.IsSet(maxByteKey) {
+		f.MaxBytes = viper.GetInt64(maxByteKey)
+	}
+	return &f
+}
+
+// Get sends a GET request of url with header. A 5xx response or a network error is retried, other responses are returned to the caller.
+// The body of the response returns ErrResponseTooLarge when it is read over MaxBytes.
+func (f *Fetcher) Get(url string, header http.Header) (*http.Response, error) {
+	wait := f.Backoff
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp, err := f.Client.Do(req)
+		if err == nil && resp.StatusCode < http.StatusInternalServerError {
+			if f.MaxBytes > 0 {
+				resp.Body = &cappedBody{ReadCloser: resp.Body, remain: f.MaxBytes}
+			}
+			return resp, nil
+		}
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("%w: %s %s", ErrDownloadStatus, url, resp.Status)
+		}
+		if attempt >= f.Retries {
+			return nil, err
+		}
+		log.Println("fetch", url, "error:", err, ", retry in", wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// ReadAll gets url and reads the whole body of a 200 response
+func (f *Fetcher) ReadAll(url string) ([]byte, http.Header, error) {
+	resp, err := f.Get(url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("%w: %s %s", ErrDownloadStatus, url, resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, resp.Header, nil
+}
+
+type cappedBody struct {
+	io.ReadCloser
+	remain int64
+}
+
+func (b *cappedBody) Read(p []byte) (int, error) {
+	if b.remain <= 0 {
+		// the cap is reached, check if there is more
+		var one [1]byte
+		for {
+			n, err := b.ReadCloser.Read(one[:])
+			if n > 0 {
+				return 0, ErrResponseTooLarge
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if int64(len(p)) > b.remain {
+		p = p[:b.remain]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remain -= int64(n)
+	return n, err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFetcher() *Fetcher {
+	return &Fetcher{Client: &http.Client{Timeout: time.Second}, Retries: 2, Backoff: time.Millisecond, MaxBytes: 16}
+}
+
+func TestFetcherRetry(t *testing.T) {
+	cases := []struct {
+		name     string
+		failures int
+		status   int
+		requests int
+		err      bool
+	}{
+		{"success", 0, http.StatusOK, 1, false},
+		{"retry 5xx", 2, http.StatusOK, 3, false},
+		{"give up", 5, http.StatusOK, 3, true},
+		{"no retry on 4xx", 0, http.StatusNotFound, 1, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= c.failures {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.WriteHeader(c.status)
+			}))
+			defer server.Close()
+			resp, err := testFetcher().Get(server.URL, nil)
+			if c.err != (err != nil) {
+				t.Fatalf("error %v, want error %v", err, c.err)
+			}
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != c.status {
+					t.Errorf("status %d, want %d", resp.StatusCode, c.status)
+				}
+			}
+			if requests != c.requests {
+				t.Errorf("requests %d, want %d", requests, c.requests)
+			}
+		})
+	}
+}
+
+func TestFetcherMaxBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", len(r.URL.Path))))
+	}))
+	defer server.Close()
+	f := testFetcher()
+	if data, _, err := f.ReadAll(server.URL + "/" + strings.Repeat("a", 15)); err != nil || len(data) != 16 {
+		t.Errorf("read %d bytes error %v, want 16 bytes", len(data), err)
+	}
+	if _, _, err := f.ReadAll(server.URL + "/" + strings.Repeat("a", 16)); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("error %v, want ErrResponseTooLarge", err)
+	}
+	resp, err := f.Get(server.URL+"/"+strings.Repeat("a", 32), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := ioutil.ReadAll(resp.Body); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("error %v, want ErrResponseTooLarge", err)
+	}
+}
+
+func TestNewFetcherMaxBytes(t *testing.T) {
+	if f := NewFetcher(httpDailyMaxByte, dailyMaxByteKey); f.MaxBytes != 5<<20 {
+		t.Errorf("daily cap %d, want 5MiB", f.MaxBytes)
+	}
+	os.Setenv("AUTONOMY_HTTP_DOWNLOADMAXBYTE", "1024")
+	defer os.Unsetenv("AUTONOMY_HTTP_DOWNLOADMAXBYTE")
+	if f := NewFetcher(httpDownloadMaxByte, downloadMaxByteKey); f.MaxBytes != 1024 {
+		t.Errorf("download cap %d, want 1024 of env", f.MaxBytes)
+	}
+	if f := NewFetcher(httpDailyMaxByte, dailyMaxByteKey); f.MaxBytes != httpDailyMaxByte {
+		t.Errorf("daily cap %d, want the default with a download cap in env", f.MaxBytes)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path"
+	"sync"
+)
+
+// FileStore is the Store which keeps each collection in a JSON-lines file under Dir.
+// A collection is loaded once and kept in memory, so it suits laptops and tests rather than big data-sets, and one process at a time.
+// Upsert appends inserted and modified records to the file, where a later line of a record replaces an earlier one,
+// so a history ingest writes each record once. Close compacts the files to one line per record.
+type FileStore struct {
+	Dir         string
+	mu          sync.Mutex
+	collections map[string]*recordSet
+	appended    map[string]bool // collections with lines appended since they were loaded
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir, collections: map[string]*recordSet{}, appended: map[string]bool{}}, nil
+}
+
+// EnsureIndex creates the collection file. Records of a file are always unique by name and report_ts.
+func (s *FileStore) EnsureIndex(collection string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path(collection), os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (s *FileStore) Upsert(collection string, records []CDSData) (UpsertResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set, err := s.collection(collection)
+	if err != nil {
+		return UpsertResult{}, err
+	}
+	changed, result := set.upsert(records)
+	if 0 == len(changed) {
+		return result, nil
+	}
+	if err := s.append(collection, changed); err != nil {
+		// reload what the file has
+		delete(s.collections, collection)
+		delete(s.appended, collection)
+		return UpsertResult{}, err
+	}
+	s.appended[collection] = true
+	return result, nil
+}
+
+func (s *FileStore) ContinuousData(loc PoliticalGeo, windowSize int64, timeBefore int64, policy GapPolicy) ([]CDSScoreDataSet, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	locFilter, err := entry.filter(loc)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set, err := s.collection(entry.Collection)
+	if err != nil {
+		return nil, ErrConfirmDataFetch
+	}
+	return continuousRecords(set.records, locFilter, windowSize, timeBefore, policy), nil
+}
+
+func (s *FileStore) Query(loc PoliticalGeo, from int64, to int64) ([]CDSData, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set, err := s.collection(entry.Collection)
+	if err != nil {
+		return nil, ErrConfirmDataFetch
+	}
+	return queryRecords(set.records, entry.queryFilter(loc), from, to), nil
+}
+
+func (s *FileStore) Latest(loc PoliticalGeo) ([]CDSData, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set, err := s.collection(entry.Collection)
+	if err != nil {
+		return nil, ErrConfirmDataFetch
+	}
+	return latestRecords(set.records, entry.queryFilter(loc)), nil
+}
+
+func (s *FileStore) SaveForecasts(forecasts []Forecast) (UpsertResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.loadForecasts()
+	if err != nil {
+		return UpsertResult{}, err
+	}
+	stored, result := upsertForecasts(stored, forecasts)
+	if err := s.saveForecasts(stored); err != nil {
+		return UpsertResult{}, err
+	}
+	return result, nil
+}
+
+func (s *FileStore) Forecasts(loc PoliticalGeo, from int64, to int64) ([]Forecast, error) {
+	s.mu.Lock()
+	stored, err := s.loadForecasts()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, ErrConfirmDataFetch
+	}
+	return queryForecasts(stored, forecastFilter(loc), from, to), nil
+}
+
+// Close compacts the files of collections which have appended lines
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for collection := range s.appended {
+		if err := s.save(collection, s.collections[collection].records); err != nil {
+			return err
+		}
+		delete(s.appended, collection)
+	}
+	return nil
+}
+
+func (s *FileStore) path(collection string) string {
+	return path.Join(s.Dir, collection+".jsonl")
+}
+
+// collection returns the records of a collection, which are loaded from its file on the first call
+func (s *FileStore) collection(collection string) (*recordSet, error) {
+	if set, ok := s.collections[collection]; ok {
+		return set, nil
+	}
+	records, err := s.load(collection)
+	if err != nil {
+		return nil, err
+	}
+	set := newRecordSet(records)
+	s.collections[collection] = set
+	s.appended[collection] = len(set.records) < len(records) // lines of an earlier process which was not closed
+	return set, nil
+}
+
+func (s *FileStore) load(collection string) ([]CDSData, error) {
+	records := []CDSData{}
+	err := s.decode(collection, func(dec *json.Decoder) error {
+		r := CDSData{}
+		if err := dec.Decode(&r); err != nil {
+			return err
+		}
+		records = append(records, r)
+		return nil
+	})
+	return records, err
+}
+
+func (s *FileStore) save(collection string, records []CDSData) error {
+	return s.encode(collection, func(enc *json.Encoder) error {
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// append writes records at the end of the collection file
+func (s *FileStore) append(collection string, records []CDSData) error {
+	f, err := os.OpenFile(s.path(collection), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *FileStore) loadForecasts() ([]Forecast, error) {
+	forecasts := []Forecast{}
+	err := s.decode(forecastCollection, func(dec *json.Decoder) error {
+		f := Forecast{}
+		if err := dec.Decode(&f); err != nil {
+			return err
+		}
+		forecasts = append(forecasts, f)
+		return nil
+	})
+	return forecasts, err
+}
+
+func (s *FileStore) saveForecasts(forecasts []Forecast) error {
+	return s.encode(forecastCollection, func(enc *json.Encoder) error {
+		for _, f := range forecasts {
+			if err := enc.Encode(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// decode calls next for each line of the collection file until the file ends. A missing file is an empty collection.
+func (s *FileStore) decode(collection string, next func(dec *json.Decoder) error) error {
+	f, err := os.Open(s.path(collection))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		if err := next(dec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode writes lines of write to a temp file and renames it over the collection file
+func (s *FileStore) encode(collection string, write func(enc *json.Encoder) error) error {
+	tmp := s.path(collection) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := write(json.NewEncoder(w)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(collection))
+}
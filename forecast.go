@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	// ModelLogLinear fits log daily new cases linearly over the days of a training window
+	ModelLogLinear = "logLinear"
+
+	forecastCollection     = "Forecast"
+	defaultForecastHorizon = 14
+	// forecastInterval is the probability of the prediction interval
+	forecastInterval = 0.95
+	// minForecastDays is the number of training days a log-linear fit needs to have a residual
+	minForecastDays = 3
+)
+
+var ErrForecastTraining = fmt.Errorf("not enough daily cases to train forecast")
+
+// Forecast is the projection of a location to a target day, made on the last day of its training window.
+// Cumulative cases start from the cumulative cases of the last training day and add the daily projections.
+type Forecast struct {
+	Name       string `json:"name" bson:"name"`
+	Country    string `json:"country" bson:"country"`
+	State      string `json:"state" bson:"state"`
+	County     string `json:"county" bson:"county"`
+	Level      string `json:"level" bson:"level"`
+	Model      string `json:"model" bson:"model"`
+	ReportTime int64  `json:"report_ts" bson:"report_ts"` // last day of the training window
+	ReportDate string `json:"report_date" bson:"report_date"`
+	TargetTime int64  `json:"target_ts" bson:"target_ts"`
+	TargetDate string `json:"target_date" bson:"target_date"`
+	Horizon    int    `json:"horizon" bson:"horizon"` // days from report_ts to target_ts
+
+	Cases      float64 `json:"cases" bson:"cases"` // cumulative cases
+	CasesLower float64 `json:"cases_lower" bson:"cases_lower"`
+	CasesUpper float64 `json:"cases_upper" bson:"cases_upper"`
+	Daily      float64 `json:"daily" bson:"daily"` // new cases of the target day
+	DailyLower float64 `json:"daily_lower" bson:"daily_lower"`
+	DailyUpper float64 `json:"daily_upper" bson:"daily_upper"`
+	Interval   float64 `json:"interval" bson:"interval"` // probability of the prediction intervals
+
+	Params    LogLinearModel `json:"params" bson:"params"`
+	TrainFrom int64          `json:"train_from_ts" bson:"train_from_ts"`
+	TrainTo   int64          `json:"train_to_ts" bson:"train_to_ts"`
+	TrainDays int            `json:"train_days" bson:"train_days"`
+}
+
+// LogLinearModel is log(daily new cases + 1) = Intercept + GrowthRate * x fitted by least squares, where x is days after the last training day.
+// MeanX and SXX keep the spread of the training days for the prediction intervals.
+type LogLinearModel struct {
+	Intercept  float64 `json:"intercept" bson:"intercept"`
+	GrowthRate float64 `json:"growth_rate" bson:"growth_rate"` // per day
+	ResidualSD float64 `json:"residual_sd" bson:"residual_sd"`
+	N          int     `json:"n" bson:"n"`
+	MeanX      float64 `json:"mean_x" bson:"mean_x"`
+	SXX        float64 `json:"sxx" bson:"sxx"`
+}
+
+// FitLogLinear fits daily new cases sorted by report_ts in ascending order. Days are placed by report_ts, so dropped days leave holes.
+// Negative new cases count as 0, and 1 is added to every day so days without new cases can be fitted.
+func FitLogLinear(data []CDSScoreDataSet) (LogLinearModel, error) {
+	if len(data) < minForecastDays {
+		return LogLinearModel{}, ErrForecastTraining
+	}
+	last := data[len(data)-1].ReportTime
+	xs := make([]float64, len(data))
+	ys := make([]float64, len(data))
+	m := LogLinearModel{N: len(data)}
+	meanY := 0.0
+	for i, d := range data {
+		xs[i] = float64(d.ReportTime-last) / secondsOfDay
+		ys[i] = math.Log(math.Max(d.Cases, 0) + 1)
+		m.MeanX += xs[i]
+		meanY += ys[i]
+	}
+	m.MeanX /= float64(m.N)
+	meanY /= float64(m.N)
+	sxy := 0.0
+	for i := range xs {
+		m.SXX += (xs[i] - m.MeanX) * (xs[i] - m.MeanX)
+		sxy += (xs[i] - m.MeanX) * (ys[i] - meanY)
+	}
+	if 0 == m.SXX {
+		return LogLinearModel{}, ErrForecastTraining
+	}
+	m.GrowthRate = sxy / m.SXX
+	m.Intercept = meanY - m.GrowthRate*m.MeanX
+	sse := 0.0
+	for i := range xs {
+		r := ys[i] - m.Intercept - m.GrowthRate*xs[i]
+		sse += r * r
+	}
+	m.ResidualSD = math.Sqrt(sse / float64(m.N-2))
+	return m, nil
+}
+
+// Predict returns the daily new cases of horizon days after the last training day and their prediction interval of probability interval
+func (m LogLinearModel) Predict(horizon int, interval float64) (float64, float64, float64) {
+	x := float64(horizon)
+	y := m.Intercept + m.GrowthRate*x
+	se := m.ResidualSD * math.Sqrt(1+1/float64(m.N)+(x-m.MeanX)*(x-m.MeanX)/m.SXX)
+	margin := studentTQuantile(float64(m.N-2), (1+interval)/2) * se
+	daily := func(y float64) float64 {
+		return math.Max(math.Exp(y)-1, 0)
+	}
+	return daily(y), daily(y - margin), daily(y + margin)
+}
+
+// ForecastLocation projects daily and cumulative cases of a location 1 to horizon days after its last report at or before asOf, trained on windowSize days.
+// Missing days are interpolated. Bounds of cumulative cases add bounds of daily cases, so they are wide rather than narrow.
+// Forecasts are sorted by target_ts in ascending order.
+func ForecastLocation(store Store, loc PoliticalGeo, windowSize int, horizon int, strategy CorrectionStrategy, asOf int64) ([]Forecast, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	contData, err := store.ContinuousData(loc, int64(windowSize), asOf, GapInterpolate)
+	if err != nil {
+		return nil, err
+	}
+	contData = cleanCorrections(contData, strategy)
+	if 0 == len(contData) {
+		return nil, ErrForecastTraining
+	}
+	last := contData[len(contData)-1]
+	records, err := store.Query(loc, last.ReportTime, last.ReportTime)
+	if err != nil {
+		return nil, err
+	}
+	cumulative := math.NaN()
+	for _, r := range records {
+		if r.Name == last.Name {
+			cumulative = r.Cases
+		}
+	}
+	if math.IsNaN(cumulative) {
+		return nil, fmt.Errorf("%w: no record of %s on %s", ErrForecastTraining, last.Name, last.ReportDate)
+	}
+	return forecastOf(loc, entry.Level, contData, cumulative, horizon)
+}
+
+// forecastOf projects loc 1 to horizon days after the last day of training, which is daily new cases sorted by report_ts in ascending order.
+// cumulative is the cumulative cases reported on the last training day.
+func forecastOf(loc PoliticalGeo, level string, training []CDSScoreDataSet, cumulative float64, horizon int) ([]Forecast, error) {
+	model, err := FitLogLinear(training)
+	if err != nil {
+		return nil, err
+	}
+	first, last := training[0], training[len(training)-1]
+	forecasts := []Forecast{}
+	cases, lower, upper := cumulative, cumulative, cumulative
+	for h := 1; h <= horizon; h++ {
+		daily, dailyLower, dailyUpper := model.Predict(h, forecastInterval)
+		cases += daily
+		lower += dailyLower
+		upper += dailyUpper
+		target := last.ReportTime + int64(h)*secondsOfDay
+		forecasts = append(forecasts, Forecast{
+			Name:       last.Name,
+			Country:    loc.Country,
+			State:      loc.State,
+			County:     loc.County,
+			Level:      level,
+			Model:      ModelLogLinear,
+			ReportTime: last.ReportTime,
+			ReportDate: last.ReportDate,
+			TargetTime: target,
+			TargetDate: time.Unix(target, 0).UTC().Format(layoutISO),
+			Horizon:    h,
+			Cases:      cases,
+			CasesLower: lower,
+			CasesUpper: upper,
+			Daily:      daily,
+			DailyLower: dailyLower,
+			DailyUpper: dailyUpper,
+			Interval:   forecastInterval,
+			Params:     model,
+			TrainFrom:  first.ReportTime,
+			TrainTo:    last.ReportTime,
+			TrainDays:  len(training),
+		})
+	}
+	return forecasts, nil
+}
+
+// forecastFilter returns the filter of forecasts of a location. State and county are optional like queryFilter.
+func forecastFilter(loc PoliticalGeo) map[string]string {
+	filter := map[string]string{"country": loc.Country}
+	if "" != loc.State {
+		filter["state"] = loc.State
+	}
+	if "" != loc.County {
+		filter["county"] = loc.County
+	}
+	return filter
+}
+
+// CDSForecast forecasts a location as of the date asOf, or its latest report when asOf is empty, and saves the forecasts to the forecast collection
+func CDSForecast(store Store, loc PoliticalGeo, windowSize int, horizon int, strategy CorrectionStrategy, asOf string) error {
+	log.Println("CDSForecast:", " country:", loc.Country, " state:", loc.State, " county:", loc.County, " window:", windowSize, " horizon:", horizon, " as of:", asOf)
+	if horizon < 1 {
+		return fmt.Errorf("invalid forecast horizon %d", horizon)
+	}
+	timeBefore := latestReportAt()
+	if "" != asOf {
+		t, err := convertDateToUTCTime(asOf)
+		if err != nil {
+			return err
+		}
+		timeBefore = t
+	}
+	forecasts, err := ForecastLocation(store, loc, windowSize, horizon, strategy, timeBefore)
+	if err != nil {
+		return err
+	}
+	last := forecasts[len(forecasts)-1]
+	log.Println("forecast", last.Name, "on", last.ReportDate, "growth rate:", last.Params.GrowthRate,
+		"cases on", last.TargetDate, ":", last.Cases, "(", last.CasesLower, "-", last.CasesUpper, ")")
+	written, err := store.SaveForecasts(forecasts)
+	log.Println("save", len(forecasts), "forecasts", written)
+	return err
+}
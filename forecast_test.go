@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"path"
+	"testing"
+)
+
+func TestFitLogLinear(t *testing.T) {
+	// daily cases + 1 grow 10% a day
+	cases := []float64{}
+	for day := 0; day < 10; day++ {
+		cases = append(cases, 10*math.Exp(0.1*float64(day))-1)
+	}
+	m, err := FitLogLinear(newCases(cases...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !almostEqual(m.GrowthRate, 0.1) || !almostEqual(m.Intercept, math.Log(10)+0.9) || m.ResidualSD > 1e-9 || m.N != 10 {
+		t.Errorf("model %+v, want growth rate 0.1 without residual", m)
+	}
+	daily, lower, upper := m.Predict(3, forecastInterval)
+	if want := 10*math.Exp(1.2) - 1; !almostEqual(daily, want) || !almostEqual(lower, want) || !almostEqual(upper, want) {
+		t.Errorf("prediction %v (%v - %v), want %v", daily, lower, upper, want)
+	}
+
+	noisy, err := FitLogLinear(newCases(10, 14, 11, 17, 15, 22, 18, 25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily7, lower7, upper7 := noisy.Predict(7, forecastInterval)
+	daily14, lower14, upper14 := noisy.Predict(14, forecastInterval)
+	if !(lower7 < daily7 && daily7 < upper7) || upper14-lower14 <= upper7-lower7 || daily14 <= daily7 {
+		t.Errorf("predictions %v (%v - %v) and %v (%v - %v), want growing and wider", daily7, lower7, upper7, daily14, lower14, upper14)
+	}
+
+	if _, err := FitLogLinear(newCases(1, 2)); err != ErrForecastTraining {
+		t.Errorf("error %v of 2 days, want ErrForecastTraining", err)
+	}
+}
+
+func TestForecastLocation(t *testing.T) {
+	useDataDir(t)
+	store := NewMemoryStore()
+	loc := PoliticalGeo{Country: CdsIceland}
+	if err := CDSHistoryToDB(store, path.Join("testdata", "timeseries-byLocation.json"), loc, 0); err != nil {
+		t.Fatal(err)
+	}
+	asOf, _ := convertDateToUTCTime("2020-04-15")
+	forecasts, err := ForecastLocation(store, loc, 7, defaultForecastHorizon, CorrectionClamp, asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forecasts) != defaultForecastHorizon {
+		t.Fatalf("forecasts %d, want %d", len(forecasts), defaultForecastHorizon)
+	}
+	records, _ := store.Query(loc, asOf, asOf)
+	first, last := forecasts[0], forecasts[len(forecasts)-1]
+	if first.ReportDate != "2020-04-15" || first.TargetDate != "2020-04-16" || last.TargetDate != "2020-04-29" || last.Horizon != 14 {
+		t.Errorf("forecast dates %+v to %+v", first, last)
+	}
+	if !almostEqual(first.Cases, records[0].Cases+first.Daily) || first.TrainDays != 7 || first.TrainTo != asOf || first.Model != ModelLogLinear || first.Level != "country" {
+		t.Errorf("first forecast %+v, want cases after %v", first, records[0].Cases)
+	}
+	for i, f := range forecasts {
+		if !(f.CasesLower <= f.Cases && f.Cases <= f.CasesUpper) || (i > 0 && f.Cases < forecasts[i-1].Cases) {
+			t.Errorf("forecast %+v out of its interval or decreasing", f)
+		}
+	}
+
+	if err := CDSForecast(store, loc, 7, 7, CorrectionClamp, "2020-04-15"); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := store.Forecasts(loc, 0, 0)
+	if len(saved) != 7 || saved[0] != forecasts[0] {
+		t.Errorf("saved forecasts %+v, want 7 forecasts of 2020-04-15", saved)
+	}
+	if err := CDSForecast(store, loc, 7, 0, CorrectionClamp, ""); err == nil {
+		t.Error("expect error of horizon 0")
+	}
+	before, _ := convertDateToUTCTime("2020-04-01")
+	if _, err := ForecastLocation(store, loc, 7, 7, CorrectionClamp, before); !errors.Is(err, ErrForecastTraining) {
+		t.Errorf("error %v before the history, want ErrForecastTraining", err)
+	}
+}
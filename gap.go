@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const secondsOfDay = 86400
+
+// GapPolicy decides how days missing between two records of a location are handled
+type GapPolicy string
+
+const (
+	// GapReport keeps new cases of a gap in one point and flags it
+	GapReport GapPolicy = "report"
+	// GapInterpolate interpolates cumulative counts of missing days linearly and flags the interpolated points
+	GapInterpolate GapPolicy = "interpolate"
+)
+
+func ParseGapPolicy(policy string) (GapPolicy, error) {
+	switch GapPolicy(policy) {
+	case GapReport, GapInterpolate:
+		return GapPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("unknown gap policy %s", policy)
+	}
+}
+
+// gapDelta returns daily new counts from cumulative counts prev to now in ascending order.
+// It is one point unless days are missing between them and policy is GapInterpolate.
+func gapDelta(now, prev CDSScoreDataSet, policy GapPolicy) []CDSScoreDataSet {
+	delta := CDSScoreDataSet{
+		Name:       now.Name,
+		Cases:      now.Cases - prev.Cases,
+		Deaths:     now.Deaths - prev.Deaths,
+		Recovered:  now.Recovered - prev.Recovered,
+		Active:     now.Active - prev.Active,
+		Population: now.Population,
+		ReportTime: now.ReportTime,
+		ReportDate: now.ReportDate,
+	}
+	days := (now.ReportTime - prev.ReportTime) / secondsOfDay
+	if days <= 1 {
+		return []CDSScoreDataSet{delta}
+	}
+	if policy != GapInterpolate {
+		delta.Gap = true
+		return []CDSScoreDataSet{delta}
+	}
+	points := make([]CDSScoreDataSet, 0, days)
+	for day := int64(1); day <= days; day++ {
+		reportTime := prev.ReportTime + day*secondsOfDay
+		points = append(points, CDSScoreDataSet{
+			Name:       now.Name,
+			Cases:      delta.Cases / float64(days),
+			Deaths:     delta.Deaths / float64(days),
+			Recovered:  delta.Recovered / float64(days),
+			Active:     delta.Active / float64(days),
+			Population: now.Population,
+			ReportTime: reportTime,
+			ReportDate: time.Unix(reportTime, 0).UTC().Format(layoutISO),
+			Gap:        true,
+		})
+	}
+	points[len(points)-1].ReportDate = now.ReportDate
+	return points
+}
+
+// gapPoints counts points of data which are computed over missing days
+func gapPoints(data []CDSScoreDataSet) int {
+	count := 0
+	for _, d := range data {
+		if d.Gap {
+			count++
+		}
+	}
+	return count
+}
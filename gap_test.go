@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func cumulative(dates []string, cases []float64) []CDSScoreDataSet {
+	docs := []CDSScoreDataSet{}
+	for i := len(dates) - 1; i >= 0; i-- { // descending like the query
+		reportTime, _ := convertDateToUTCTime(dates[i])
+		docs = append(docs, CDSScoreDataSet{Name: "test", ReportTime: reportTime, ReportDate: dates[i], Cases: cases[i]})
+	}
+	return docs
+}
+
+func TestContinuousDeltaGap(t *testing.T) {
+	docs := cumulative([]string{"2020-04-01", "2020-04-02", "2020-04-05", "2020-04-06"}, []float64{10, 12, 18, 20})
+
+	reported := continuousDelta(docs, 14, GapReport)
+	if len(reported) != 3 {
+		t.Fatalf("report %+v, want 3 points", reported)
+	}
+	if !reported[1].Gap || reported[1].Cases != 6 || reported[0].Gap || reported[2].Gap {
+		t.Errorf("report %+v, want only the 3-day gap flagged with 6 cases", reported)
+	}
+
+	interpolated := continuousDelta(docs, 14, GapInterpolate)
+	wantDates := []string{"2020-04-02", "2020-04-03", "2020-04-04", "2020-04-05", "2020-04-06"}
+	wantCases := []float64{2, 2, 2, 2, 2}
+	wantGap := []bool{false, true, true, true, false}
+	if len(interpolated) != len(wantDates) {
+		t.Fatalf("interpolate %+v, want %d points", interpolated, len(wantDates))
+	}
+	for i, d := range interpolated {
+		if d.ReportDate != wantDates[i] || d.Cases != wantCases[i] || d.Gap != wantGap[i] {
+			t.Errorf("point %d %+v, want %s %f gap %v", i, d, wantDates[i], wantCases[i], wantGap[i])
+		}
+	}
+	if points := gapPoints(interpolated); points != 3 {
+		t.Errorf("gap points %d, want 3", points)
+	}
+
+	if window := continuousDelta(docs, 2, GapInterpolate); len(window) != 2 || window[1].ReportDate != "2020-04-06" {
+		t.Errorf("window %+v, want the last 2 days", window)
+	}
+}
+
+func TestParseGapPolicy(t *testing.T) {
+	if _, err := ParseGapPolicy("skip"); err == nil {
+		t.Error("expect unknown policy error")
+	}
+	if policy, err := ParseGapPolicy("interpolate"); err != nil || policy != GapInterpolate {
+		t.Errorf("policy %s error %v", policy, err)
+	}
+}
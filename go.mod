@@ -11,7 +11,6 @@ require (
 	github.com/go-playground/validator/v10 v10.3.0 // indirect
 	github.com/golang/protobuf v1.4.2 // indirect
 	github.com/jcmturner/gokrb5/v8 v8.3.0 // indirect
-	github.com/klauspost/compress v1.10.6 // indirect
 	github.com/lib/pq v1.6.0 // indirect
 	github.com/mitchellh/mapstructure v1.3.1 // indirect
 	github.com/mohae/struct2csv v0.0.0-20151122200941-e72239694eae
@@ -24,9 +23,9 @@ require (
 	github.com/spf13/cast v1.3.1 // indirect
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
 	github.com/spf13/viper v1.7.0
-	github.com/stretchr/testify v1.6.0 // indirect
 	github.com/uber-go/tally v3.3.16+incompatible // indirect
 	github.com/uber/tchannel-go v1.19.0 // indirect
+	github.com/xitongsys/parquet-go v1.6.2
 	go.mongodb.org/mongo-driver v1.3.3
 	go.opencensus.io v0.22.3 // indirect
 	go.uber.org/cadence v0.12.0 // indirect
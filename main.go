@@ -4,11 +4,10 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"time"
 
 	"github.com/bitmark-inc/autonomy-api/schema"
@@ -17,290 +16,503 @@ import (
 var USAData []schema.CDSData
 
 const (
-	DataDir                     = "data"
-	CollectionConfirmUS         = "ConfirmUS"
-	CollectionConfirmTaiwan     = "ConfirmTaiwan"
-	CollectionConfirmIceland    = "ConfirmIceland"
-	DuplicateKeyCode            = 11000
-	coronaDataScraperDailyURL   = "https://coronadatascraper.com/data.json"
-	coronaDataScraperHistoryURL = "https://coronadatascraper.com/timeseries-byLocation.json"
-	keepDaysInHistory           = 30
+	DataDir                      = "data"
+	DuplicateKeyCode             = 11000
+	coronaDataScraperDailyURL    = "https://coronadatascraper.com/data.json"
+	coronaDataScraperHistoryURL  = "https://coronadatascraper.com/timeseries-byLocation.json"
+	coronaDataScraperByDateURL   = "https://coronadatascraper.com/timeseries.json"
+	coronaDataScraperLocationURL = "https://coronadatascraper.com/locations.json"
+	keepDaysInHistory            = 30
 )
 
 var job string
 var country string
-var state string  // for analysis
-var county string // for analysis
+var state string  // for ingest and analysis
+var county string // for ingest and analysis
+var countriesFile string
+var batchSize int
+var storeKind string
+var dataDir string
+var offline bool
+var windowSize int
+var decay float64
+var scorerNames string
+var gapPolicy string
+var correctionStrategy string
+var storeDir string
+var scheduleFile string
+var apiAddr string
+var exportFormat string
+var out string
+var from string
+var to string
+var level string
+var workers int
+var seriesNames string
+var siMean float64
+var siSD float64
+var siWeights string
+var rtWindow int
+var horizon int
+var anomalyThreshold float64
 
 func init() {
-	flag.StringVar(&job, "job", "history", "select from history/daily/online")
+	flag.StringVar(&job, "job", "history", "select from history/historyAll/historyByDate/daily/dailyOnline/historyDownload/historyByDateDownload/analysis/analysisAll/rt/forecast/backtest/export/serve/api")
 	flag.StringVar(&country, "country", "country", "ie. United States / Taiwan / Iceland")
-	flag.StringVar(&state, "state", "California", "If you are using United State Data, you need to specify State. ie. California")
-	flag.StringVar(&county, "county", "Santa Clara County", "If you are using United State Data, you need to specify County. ie. Santa Clara County")
+	flag.StringVar(&state, "state", "", "ingest only this state. If you are analysing United State Data, you need to specify State. ie. California")
+	flag.StringVar(&county, "county", "", "ingest only this county. If you are analysing United State Data, you need to specify County. ie. Santa Clara County")
+	flag.IntVar(&batchSize, "batch", defaultHistoryBatchSize, "number of records written to db at once")
+	flag.StringVar(&storeKind, "store", StoreMongo, "select from mongo/file/memory. memory keeps nothing after the job")
+	flag.StringVar(&storeDir, "storeDir", "", "directory of the file store (default {dataDir}/store)")
+	flag.StringVar(&dataDir, "dataDir", DataDir, "directory of CDS files and analysis output")
+	flag.BoolVar(&offline, "offline", false, "use CDS files in dataDir without downloading them, ie. fixtures")
+	flag.IntVar(&windowSize, "window", defaultWindowSize, "number of days of a window in analysis")
+	flag.Float64Var(&decay, "decay", defaultDecay, "weight decay of exponential score. weight of day idx is exp((idx+1)*decay)")
+	flag.StringVar(&scorerNames, "scorers", defaultScorers, "comma separated scorers from exponential/movingAverage/growthRatio/doublingTime")
+	flag.StringVar(&seriesNames, "series", defaultSeries, "comma separated series scored by each scorer from cases/deaths/recovered/active. active is scored by movingAverage only")
+	flag.Float64Var(&siMean, "siMean", defaultSIMean, "mean days of the gamma serial interval of job rt")
+	flag.Float64Var(&siSD, "siSD", defaultSISD, "standard deviation in days of the gamma serial interval of job rt")
+	flag.StringVar(&siWeights, "siWeights", "", "comma separated serial interval weights of day 1, 2, ... of job rt, instead of the gamma serial interval")
+	flag.IntVar(&rtWindow, "rtWindow", defaultRtWindow, "number of days Rt is assumed constant over in job rt")
+	flag.IntVar(&horizon, "horizon", defaultForecastHorizon, "number of days job forecast projects after the last report, and job backtest compares growth over")
+	flag.Float64Var(&anomalyThreshold, "anomaly", defaultAnomalyThreshold, "robust z-score of daily growth over which jobs daily/dailyOnline quarantine a record for review. 0 disables the anomaly check")
+	flag.StringVar(&gapPolicy, "gapPolicy", string(GapReport), "how missing days are handled in analysis. select from report/interpolate")
+	flag.StringVar(&correctionStrategy, "correction", string(CorrectionClamp), "how negative daily cases and deaths are cleaned in analysis. select from clamp/distribute/drop/none")
+	flag.StringVar(&scheduleFile, "schedule", "", "schedule config file (json/yaml/toml) of job serve")
+	flag.StringVar(&apiAddr, "addr", "", "listen address of job api (default :8080). job serve serves the api too when it is given")
+	flag.StringVar(&exportFormat, "format", FormatCSV, "output format of analysis and export. select from csv/json/jsonl/parquet")
+	flag.StringVar(&out, "out", "", "output file of analysis and export, - for stdout (default {dataDir}/{name}-{date}.{format})")
+	flag.StringVar(&from, "from", "", "export records reported from the date, or backtest from the date, ie. 2020-04-01")
+	flag.StringVar(&to, "to", "", "export records reported to the date, forecast as of the date, or backtest to the date, ie. 2020-04-20")
+	flag.StringVar(&level, "level", "", "level of locations scored by analysisAll and backtest, ie. county (default level of the country)")
+	flag.IntVar(&workers, "workers", defaultAnalysisWorkers, "number of locations scored at once by analysisAll")
+	flag.StringVar(&countriesFile, "countries", "", "country registry config file (json/yaml/toml). United States / Taiwan / Iceland are registered by default")
 }
 
+const (
+	exitJobFail        = 1
+	exitConnectionFail = 2
+	exitPartialWrite   = 3
+)
+
 func main() {
 	//go PrintUsage()
 	flag.Parse()
 
-	client, err := NewMongoConnect()
-	if err != nil {
-		fmt.Println("connect to autonomy db error:", err)
-		return
+	if err := runJob(); err != nil {
+		log.Println("job", job, "fail:", err)
+		os.Exit(exitCode(err))
 	}
-	switch job {
-	case "historyDownload":
-		CDSDownloadHistory(coronaDataScraperHistoryURL)
-	case "history":
-		CDSDownloadHistory(coronaDataScraperHistoryURL)
-		file, err := getDataFilePath(CDSTimeseriesLocationFile)
-		if err != nil {
-			fmt.Println(err.Error())
-			return
-		}
-		keepDays := time.Now().UTC().Unix() - 60*60*24*keepDaysInHistory
-		CDSHistoryToDB(client, file, country, keepDays)
-	case "daily":
-		file, _ := getDataFilePath(CDSDaily)
-		log.Println("filepath=", file)
-		err := CDSDailyUpdate(client, file, country)
-		if err != nil {
-			fmt.Println("parse daily err", err)
-		}
-	case "dailyOnline":
-		err := CDSDailyOnline(client, coronaDataScraperDailyURL, country)
-		if err != nil {
-			fmt.Println("parse daily online err", err)
-		}
-	case "historyAll":
-		CDSDownloadHistory(coronaDataScraperHistoryURL)
-		file, err := getDataFilePath(CDSTimeseriesLocationFile)
-		if err != nil {
-			fmt.Println(err.Error())
-			return
-		}
-		CDSHistoryToDB(client, file, country, 0)
-	case "analysis":
-		loc := PoliticalGeo{Country: country, State: state, County: county}
-		ExponientialScoreOfAllTime(client, loc)
+}
 
+// exitCode maps a job error to the exit code of the process, so schedulers can alert on the kind of failure
+func exitCode(err error) int {
+	var connErr *ConnectionError
+	var partialErr *PartialWriteError
+	switch {
+	case errors.As(err, &connErr):
+		return exitConnectionFail
+	case errors.As(err, &partialErr):
+		return exitPartialWrite
+	default:
+		return exitJobFail
 	}
 }
 
-func getDataFilePath(source CovidSource) (string, error) {
-	working, err := os.Getwd()
-	if err != nil {
-		return "", err
+func runJob() error {
+	if len(countriesFile) > 0 {
+		r, err := LoadCDSCountryRegistry(countriesFile)
+		if err != nil {
+			return fmt.Errorf("load country registry error: %w", err)
+		}
+		registry = r
 	}
-	switch source {
-	case CDSTimeseriesLocationFile:
-		path := path.Join(working, DataDir, "timeseries-byLocation.json")
-		return path, nil
-	case CDSDaily:
-		path := path.Join(working, DataDir, "dataDaily.json")
-		return path, nil
-	default:
-		return "", errors.New("no data source")
+
+	if download, ok := downloadJobs[job]; ok {
+		return download()
 	}
-	return "", nil
-}
 
-func CDSDownloadHistory(url string) error {
-	// Get the data
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
+	if "" == storeDir {
+		storeDir = path.Join(dataDir, "store")
 	}
-	defer resp.Body.Close()
-	file, err := getDataFilePath(CDSTimeseriesLocationFile)
+	store, err := NewStore(storeKind, storeDir, batchSize)
 	if err != nil {
-		return err
+		return fmt.Errorf("open %s store error: %w", storeKind, err)
 	}
-	// Create the file
-	out, err := os.Create(file)
-	if err != nil {
-		return err
+	defer store.Close()
+	switch job {
+	case "serve":
+		return serve(store)
+	case "api":
+		server, err := newAPIServer(store)
+		if err != nil {
+			return err
+		}
+		addr := apiAddr
+		if "" == addr {
+			addr = defaultAPIAddr
+		}
+		return serveAPI(server, addr, stopOnSignal())
 	}
-	defer out.Close()
+	return runStoreJob(store, job, PoliticalGeo{Country: country, State: state, County: county})
+}
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	return err
+// downloadJobs are jobs which only download CDS files, so they run without a store
+var downloadJobs = map[string]func() error{
+	"historyDownload": func() error {
+		return CDSDownloadHistory(coronaDataScraperHistoryURL)
+	},
+	"historyByDateDownload": CDSDownloadHistoryByDate,
 }
 
-func CDSHistoryToDB(client *MongoClient, cdsFile string, country string, noEarlier int64) {
-	fmt.Println("CDSDailyUpdate:", " parse file:", cdsFile, " country:", country, " noEarlier:", noEarlier)
-	f, err := os.Open(cdsFile)
-	if err != nil {
-		fmt.Println(err.Error())
-		return
-	}
-	defer f.Close()
+// storeJobs are jobs of runStoreJob, which a schedule task can run
+var storeJobs = map[string]bool{
+	"history": true, "historyAll": true, "historyByDate": true, "daily": true, "dailyOnline": true,
+	"analysis": true, "analysisAll": true, "rt": true, "forecast": true, "backtest": true, "export": true,
+}
 
-	switch country {
-	case "United States":
-		parser := NewCDSParser(CDSTimeseriesLocationFile, "United State", "county", f, "")
-		cnt, rawRecordCount, err := parser.ParseHistory(noEarlier)
-		if err != nil {
-			log.Println("US Data Parse Error", err)
-			return
+// runStoreJob runs a job of loc which reads or writes store
+func runStoreJob(store Store, job string, loc PoliticalGeo) error {
+	switch job {
+	case "history":
+		if err := downloadUnlessOffline(CDSDownloadHistory, coronaDataScraperHistoryURL); err != nil {
+			return err
 		}
-		log.Println("US data get:", cnt, " rawRecordCount in file:", rawRecordCount)
-
-		err = setIndex(client, CollectionConfirmUS)
+		file, err := getDataFilePath(CDSTimeseriesLocationFile)
 		if err != nil {
-			fmt.Println("set ConfirmUS index error:", err)
-			return
+			return err
 		}
-		err = createCDSData(client, parser.Result, CollectionConfirmUS)
+		keepDays := time.Now().UTC().Unix() - 60*60*24*keepDaysInHistory
+		return CDSHistoryToDB(store, file, loc, keepDays)
+	case "daily":
+		file, err := getDataFilePath(CDSDaily)
 		if err != nil {
-			fmt.Println("create US CDSData error:", err)
-			return
+			return err
 		}
-	case "Taiwan":
-		err = setIndex(client, CollectionConfirmTaiwan)
-		if err != nil {
-			fmt.Println("set ConfirmTW index error:", err)
-			return
+		log.Println("filepath=", file)
+		return CDSDailyUpdate(store, file, loc)
+	case "dailyOnline":
+		return CDSDailyOnline(store, coronaDataScraperDailyURL, loc)
+	case "historyAll":
+		if err := downloadUnlessOffline(CDSDownloadHistory, coronaDataScraperHistoryURL); err != nil {
+			return err
 		}
-		parserTW := NewCDSParser(CDSTimeseriesLocationFile, "Taiwan", "country", f, "")
-		cnt, rawRecordCount, err := parserTW.ParseHistory(noEarlier)
+		file, err := getDataFilePath(CDSTimeseriesLocationFile)
 		if err != nil {
-			log.Println("Taiwan  Data Parse Error", err)
-			return
+			return err
 		}
-		log.Println("Taiwan data get:", cnt, " rawRecordCount in file:", rawRecordCount)
-		err = createCDSData(client, parserTW.Result, CollectionConfirmTaiwan)
+		return CDSHistoryToDB(store, file, loc, 0)
+	case "historyByDate":
+		if !offline {
+			if err := CDSDownloadHistoryByDate(); err != nil {
+				return err
+			}
+		}
+		file, err := getDataFilePath(CDSTimeseriesByDateFile)
 		if err != nil {
-			fmt.Println("create Taiwan CDSData error:", err)
-			return
+			return err
 		}
-	case "Iceland":
-		err = setIndex(client, CollectionConfirmIceland)
+		locationFile, err := getDataFilePath(CDSLocationsFile)
 		if err != nil {
-			fmt.Println("set confirm Iceland index error:", err)
-			return
+			return err
 		}
-		parserIceland := NewCDSParser(CDSTimeseriesLocationFile, "Iceland", "country", f, "")
-		cnt, rawRecordCount, err := parserIceland.ParseHistory(noEarlier)
+		keepDays := time.Now().UTC().Unix() - 60*60*24*keepDaysInHistory
+		return CDSHistoryByDateToDB(store, file, locationFile, loc, keepDays)
+	case "analysis", "analysisAll", "backtest":
+		scorers, err := NewScorers(scorerNames, windowSize, decay)
 		if err != nil {
-			log.Println("Iceland  Data Parse Error", err)
-			return
+			return err
 		}
-		log.Println("Iceland data get:", cnt, " rawRecordCount in file:", rawRecordCount)
-		err = createCDSData(client, parserIceland.Result, CollectionConfirmIceland)
+		series, err := ParseSeries(seriesNames)
 		if err != nil {
-			fmt.Println("create Iceland CDSData error:", err)
-			return
+			return err
 		}
-	default:
-		fmt.Println("No Data Set for ", country)
-	}
-}
-
-func CDSDailyUpdate(client *MongoClient, cdsFile string, country string) error {
-	fmt.Println("CDSDailyUpdate:", " parse file:", cdsFile, " country:", country)
-	f, err := os.Open(cdsFile)
-	if err != nil {
-		fmt.Println(err.Error())
-		return err
-	}
-	defer f.Close()
-	switch country {
-	case "United States":
-		parserUS := NewCDSParser(CDSDaily, "United State", "county", f, "")
-		cnt, err := parserUS.ParseDaily()
+		scorers, err = ForSeries(scorers, series)
 		if err != nil {
-			fmt.Println("parse US daily error:", err)
 			return err
 		}
-		fmt.Println("parse us daily cnt:", cnt)
-		err = ReplaceCDS(client, parserUS.Result, CollectionConfirmUS)
+		policy, err := ParseGapPolicy(gapPolicy)
 		if err != nil {
-			fmt.Println("create US CDSData error:", err)
 			return err
 		}
-	case "Taiwan":
-		parserTW := NewCDSParser(CDSDaily, "Taiwan", "country", f, "")
-		cnt, err := parserTW.ParseDaily()
-		f.Close()
+		strategy, err := ParseCorrectionStrategy(correctionStrategy)
 		if err != nil {
-			fmt.Println("parse Taiwan daily error:", err)
 			return err
 		}
-		fmt.Println("parse Taiwan daily cnt:", cnt)
-		err = ReplaceCDS(client, parserTW.Result, CollectionConfirmTaiwan)
+		format, err := ParseExportFormat(exportFormat)
 		if err != nil {
-			fmt.Println("create Taiwan CDSData error:", err)
 			return err
 		}
-	case "Iceland":
-		parserIceland := NewCDSParser(CDSDaily, "Iceland", "country", f, "")
-		cnt, err := parserIceland.ParseDaily()
-		f.Close()
+		if "backtest" == job {
+			return CDSBacktest(store, loc, level, scorers, windowSize, policy, strategy, horizon, from, to, format, out)
+		}
+		if "analysisAll" == job {
+			return ScoreOfAllLocations(store, loc, level, scorers, windowSize, policy, strategy, workers, format, out)
+		}
+		return ScoreOfAllTime(store, loc, scorers, windowSize, policy, strategy, format, out)
+	case "rt":
+		si, err := NewSerialInterval(siMean, siSD, siWeights)
 		if err != nil {
-			fmt.Println("parse Iceland daily error:", err)
 			return err
 		}
-		fmt.Println("parse Taiwan daily cnt:", cnt)
-		err = ReplaceCDS(client, parserIceland.Result, CollectionConfirmIceland)
+		strategy, err := ParseCorrectionStrategy(correctionStrategy)
 		if err != nil {
-			fmt.Println("create Iceland CDSData error:", err)
 			return err
 		}
-	default:
-		fmt.Println("No Data Set for ", country)
-		return errors.New("country has no data-set")
-	}
-	return nil
-}
-
-func CDSDailyOnline(client *MongoClient, url string, country string) error {
-	fmt.Println("CDSDailyOnline:", " url:", url, " country:", country)
-	switch country {
-	case "United States":
-		parserUS := NewCDSParser(CDSDaily, "United States", "county", nil, url)
-		cnt, err := parserUS.ParseDailyOnline()
+		format, err := ParseExportFormat(exportFormat)
 		if err != nil {
-			fmt.Println("parse US daily error:", err)
 			return err
 		}
-		fmt.Println("parse us daily cnt:", cnt)
-		err = ReplaceCDS(client, parserUS.Result, CollectionConfirmUS)
+		return RtOfAllTime(store, loc, si, rtWindow, strategy, format, out)
+	case "forecast":
+		strategy, err := ParseCorrectionStrategy(correctionStrategy)
 		if err != nil {
-			fmt.Println("create US CDSData error:", err)
 			return err
 		}
-	case "Taiwan":
-		parserTW := NewCDSParser(CDSDaily, "Taiwan", "country", nil, url)
-		cnt, err := parserTW.ParseDailyOnline()
+		return CDSForecast(store, loc, windowSize, horizon, strategy, to)
+	case "export":
+		format, err := ParseExportFormat(exportFormat)
 		if err != nil {
-			fmt.Println("parse TW daily error:", err)
 			return err
 		}
-		fmt.Println("parse tw daily cnt:", cnt)
-		err = ReplaceCDS(client, parserTW.Result, CollectionConfirmTaiwan)
+		return CDSExport(store, loc, from, to, format, out)
+	default:
+		return fmt.Errorf("unknown job %s", job)
+	}
+}
+
+// dataDirPath returns the absolute path of the data directory
+func dataDirPath() (string, error) {
+	if filepath.IsAbs(dataDir) {
+		return dataDir, nil
+	}
+	working, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(working, dataDir), nil
+}
+
+func getDataFilePath(source CovidSource) (string, error) {
+	working, err := dataDirPath()
+	if err != nil {
+		return "", err
+	}
+	switch source {
+	case CDSTimeseriesLocationFile:
+		path := path.Join(working, "timeseries-byLocation.json")
+		return path, nil
+	case CDSTimeseriesByDateFile:
+		path := path.Join(working, "timeseries-byDate.json")
+		return path, nil
+	case CDSLocationsFile:
+		path := path.Join(working, "locations.json")
+		return path, nil
+	case CDSDaily:
+		path := path.Join(working, "dataDaily.json")
+		return path, nil
+	default:
+		return "", errors.New("no data source")
+	}
+}
+
+func downloadUnlessOffline(download func(string) error, url string) error {
+	if offline {
+		log.Println("offline: use the file in", dataDir, "instead of", url)
+		return nil
+	}
+	return download(url)
+}
+
+func CDSDownloadHistory(url string) error {
+	return CDSDownload(url, CDSTimeseriesLocationFile)
+}
+
+// CDSDownloadHistoryByDate downloads timeseries-byDate.json and the locations.json it references
+func CDSDownloadHistoryByDate() error {
+	if err := CDSDownload(coronaDataScraperByDateURL, CDSTimeseriesByDateFile); err != nil {
+		return err
+	}
+	return CDSDownload(coronaDataScraperLocationURL, CDSLocationsFile)
+}
+
+func CDSHistoryToDB(store Store, cdsFile string, loc PoliticalGeo, noEarlier int64) error {
+	log.Println("CDSDailyUpdate:", " parse file:", cdsFile, " country:", loc.Country, " noEarlier:", noEarlier)
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		log.Println("No Data Set for ", loc.Country)
+		return err
+	}
+	f, err := os.Open(cdsFile)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	defer f.Close()
+
+	err = store.EnsureIndex(entry.Collection)
+	if err != nil {
+		log.Println("set", entry.Collection, "index error:", err)
+		return err
+	}
+	parser := NewCDSParser(CDSTimeseriesLocationFile, entry.locationFilter(loc.State, loc.County), entry.Level, f, "")
+	written := UpsertResult{}
+	cnt, rawRecordCount, err := parser.ParseHistory(noEarlier, batchSize, func(records []CDSData) error {
+		res, err := store.Upsert(entry.Collection, records)
+		written.Add(res)
 		if err != nil {
-			fmt.Println("create Taiwan CDSData error:", err)
+			log.Println("upsert", loc.Country, "CDSData error:", err)
 			return err
 		}
-	case "Iceland":
-		parserIceland := NewCDSParser(CDSDaily, "Iceland", "country", nil, url)
-		cnt, err := parserIceland.ParseDailyOnline()
+		return nil
+	})
+	log.Println(loc.Country, "data get:", cnt, " rawRecordCount in file:", rawRecordCount, written)
+	if err != nil {
+		log.Println(loc.Country, "Data Parse Error", err)
+		return err
+	}
+	return nil
+}
+
+func CDSHistoryByDateToDB(store Store, cdsFile string, locationFile string, loc PoliticalGeo, noEarlier int64) error {
+	log.Println("CDSHistoryByDateToDB:", " parse file:", cdsFile, " locations:", locationFile, " country:", loc.Country, " noEarlier:", noEarlier)
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		log.Println("No Data Set for ", loc.Country)
+		return err
+	}
+	f, err := os.Open(cdsFile)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	defer f.Close()
+	lf, err := os.Open(locationFile)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	defer lf.Close()
+
+	err = store.EnsureIndex(entry.Collection)
+	if err != nil {
+		log.Println("set", entry.Collection, "index error:", err)
+		return err
+	}
+	parser := NewCDSParser(CDSTimeseriesByDateFile, entry.locationFilter(loc.State, loc.County), entry.Level, f, "")
+	written := UpsertResult{}
+	cnt, locationCount, err := parser.ParseHistoryByDate(lf, noEarlier, batchSize, func(records []CDSData) error {
+		res, err := store.Upsert(entry.Collection, records)
+		written.Add(res)
 		if err != nil {
-			fmt.Println("parse Iceland daily error:", err)
+			log.Println("upsert", loc.Country, "CDSData error:", err)
 			return err
 		}
-		fmt.Println("parse Iceland daily cnt:", cnt)
-		err = ReplaceCDS(client, parserIceland.Result, CollectionConfirmIceland)
+		return nil
+	})
+	log.Println(loc.Country, "data get:", cnt, " matched locations:", locationCount, written)
+	if err != nil {
+		log.Println(loc.Country, "Data Parse Error", err)
+		return err
+	}
+	return nil
+}
+
+func CDSDailyUpdate(store Store, cdsFile string, loc PoliticalGeo) error {
+	log.Println("CDSDailyUpdate:", " parse file:", cdsFile, " country:", loc.Country)
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		log.Println("No Data Set for ", loc.Country)
+		return err
+	}
+	f, err := os.Open(cdsFile)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+	defer f.Close()
+
+	parser := NewCDSParser(CDSDaily, entry.locationFilter(loc.State, loc.County), entry.Level, f, "")
+	cnt, err := parser.ParseDaily()
+	if err != nil {
+		log.Println("parse", loc.Country, "daily error:", err)
+		return err
+	}
+	log.Println("parse", loc.Country, "daily cnt:", cnt)
+	return upsertDaily(store, entry, loc, parser.Result)
+}
+
+func CDSDailyOnline(store Store, url string, loc PoliticalGeo) error {
+	log.Println("CDSDailyOnline:", " url:", url, " country:", loc.Country)
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		log.Println("No Data Set for ", loc.Country)
+		return err
+	}
+	parser := NewCDSParser(CDSDaily, entry.locationFilter(loc.State, loc.County), entry.Level, nil, url)
+	cnt, err := parser.ParseDailyOnline()
+	if err != nil {
+		log.Println("parse", loc.Country, "daily error:", err)
+		return err
+	}
+	log.Println("parse", loc.Country, "daily cnt:", cnt)
+	return upsertDaily(store, entry, loc, parser.Result)
+}
+
+// upsertDaily writes daily records of loc which pass the anomaly check, and quarantines the others to the review collection instead of
+// overwriting the stored day. The check is skipped when anomalyThreshold is not positive.
+func upsertDaily(store Store, entry CDSCountry, loc PoliticalGeo, records []CDSData) error {
+	anomalies := []Anomaly{}
+	if anomalyThreshold > 0 {
+		accepted, found, err := CheckAnomalies(store, loc, records, anomalyThreshold)
 		if err != nil {
-			fmt.Println("create Iceland CDSData error:", err)
+			log.Println("check", loc.Country, "daily anomaly error:", err)
 			return err
 		}
-	default:
-		fmt.Println("No Data Set for ", country)
-		return errors.New("country has no data-set")
+		records, anomalies = accepted, found
+	}
+	written, err := store.Upsert(entry.Collection, records)
+	log.Println("upsert", loc.Country, "daily", written)
+	if err != nil {
+		log.Println("upsert", loc.Country, "CDSData error:", err)
+		return err
+	}
+	if 0 == len(anomalies) {
+		return nil
+	}
+	review := entry.Collection + reviewSuffix
+	quarantined := []CDSData{}
+	log.Println("daily", loc.Country, "summary:", len(records), "records written,", len(anomalies), "records quarantined to", review)
+	for _, a := range anomalies {
+		log.Println("  quarantine", a)
+		quarantined = append(quarantined, a.Record)
+	}
+	if err := store.EnsureIndex(review); err != nil {
+		log.Println("set", review, "index error:", err)
+		return err
 	}
+	if _, err := store.Upsert(review, quarantined); err != nil {
+		log.Println("upsert", loc.Country, "review error:", err)
+		return err
+	}
+	return nil
+}
 
+// CDSExport dumps records of loc reported between the dates from and to in format to out. Both dates are optional.
+func CDSExport(store Store, loc PoliticalGeo, from string, to string, format string, out string) error {
+	log.Println("CDSExport:", " country:", loc.Country, " state:", loc.State, " county:", loc.County, " from:", from, " to:", to)
+	fromTime, toTime, err := parseDateRange(from, to)
+	if err != nil {
+		return err
+	}
+	records, err := store.Query(loc, fromTime, toTime)
+	if err != nil {
+		return err
+	}
+	written, err := ExportTable(RecordTable(records), format, out, locationName(loc)+"-records")
+	if err != nil {
+		return err
+	}
+	log.Println("export", len(records), "records to", written)
 	return nil
 }
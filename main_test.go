@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+// useDataDir points dataDir to a temp directory during a test
+func useDataDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	origin := dataDir
+	dataDir = dir
+	t.Cleanup(func() {
+		dataDir = origin
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func fixtureServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCDSDownload(t *testing.T) {
+	dir := useDataDir(t)
+	server := fixtureServer(t)
+	if err := CDSDownloadHistory(server.URL + "/timeseries-byLocation.json"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path.Join(dir, "timeseries-byLocation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ioutil.ReadFile(path.Join("testdata", "timeseries-byLocation.json"))
+	if string(got) != string(want) {
+		t.Error("downloaded file is different from the source")
+	}
+}
+
+func TestCDSHistoryToDB(t *testing.T) {
+	store := NewMemoryStore()
+	file := path.Join("testdata", "timeseries-byLocation.json")
+	loc := PoliticalGeo{Country: CdsUSA, State: "California"}
+	if err := CDSHistoryToDB(store, file, loc, 0); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := registry.Lookup(CdsUSA)
+	if records := store.Records(entry.Collection); len(records) != 40 {
+		t.Errorf("records %d, want 40", len(records))
+	}
+	// run again, nothing is inserted
+	if err := CDSHistoryToDB(store, file, loc, 0); err != nil {
+		t.Fatal(err)
+	}
+	if records := store.Records(entry.Collection); len(records) != 40 {
+		t.Errorf("records %d after rerun, want 40", len(records))
+	}
+
+	if err := CDSHistoryToDB(store, file, PoliticalGeo{Country: "Germany"}, 0); err != ErrCountryNotRegistered {
+		t.Errorf("error %v, want ErrCountryNotRegistered", err)
+	}
+}
+
+func TestCDSHistoryByDateToDB(t *testing.T) {
+	store := NewMemoryStore()
+	err := CDSHistoryByDateToDB(store, path.Join("testdata", "timeseries-byDate.json"), path.Join("testdata", "locations.json"), PoliticalGeo{Country: CdsTaiwan}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records := store.Records("ConfirmTaiwan"); len(records) != 19 {
+		t.Errorf("records %d, want 19", len(records))
+	}
+}
+
+func TestCDSDailyOnline(t *testing.T) {
+	store := NewMemoryStore()
+	server := fixtureServer(t)
+	if err := CDSDailyOnline(store, server.URL+"/dataDaily.json", PoliticalGeo{Country: CdsIceland}); err != nil {
+		t.Fatal(err)
+	}
+	records := store.Records("ConfirmIceland")
+	if len(records) != 1 || records[0].Cases != 2566 {
+		t.Errorf("records %+v, want Iceland with 2566 cases", records)
+	}
+}
+
+func TestCDSDailyUpdate(t *testing.T) {
+	store := NewMemoryStore()
+	if err := CDSDailyUpdate(store, path.Join("testdata", "dataDaily.json"), PoliticalGeo{Country: CdsUSA, County: "King County"}); err != nil {
+		t.Fatal(err)
+	}
+	records := store.Records("ConfirmUS")
+	if len(records) != 1 || records[0].County != "King County" {
+		t.Errorf("records %+v, want King County only", records)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{errors.New("fail"), exitJobFail},
+		{&ConnectionError{Err: errors.New("timeout")}, exitConnectionFail},
+		{&PartialWriteError{Collection: "ConfirmUS", Failed: 1, Err: errors.New("write")}, exitPartialWrite},
+	}
+	for _, c := range cases {
+		if code := exitCode(c.err); code != c.code {
+			t.Errorf("exit code of %v is %d, want %d", c.err, code, c.code)
+		}
+	}
+}
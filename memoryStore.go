@@ -0,0 +1,288 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is the Store which keeps collections in memory. It replaces Mongo in tests.
+type MemoryStore struct {
+	mu          sync.Mutex
+	collections map[string][]CDSData
+	forecasts   []Forecast
+}
+
+type cdsRecordKey struct {
+	Name       string
+	ReportTime int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{collections: map[string][]CDSData{}}
+}
+
+func (s *MemoryStore) EnsureIndex(collection string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[collection]; !ok {
+		s.collections[collection] = []CDSData{}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Upsert(collection string, records []CDSData) (UpsertResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, result := upsertRecords(s.collections[collection], records)
+	s.collections[collection] = stored
+	return result, nil
+}
+
+func (s *MemoryStore) ContinuousData(loc PoliticalGeo, windowSize int64, timeBefore int64, policy GapPolicy) ([]CDSScoreDataSet, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	locFilter, err := entry.filter(loc)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return continuousRecords(s.collections[entry.Collection], locFilter, windowSize, timeBefore, policy), nil
+}
+
+func (s *MemoryStore) Query(loc PoliticalGeo, from int64, to int64) ([]CDSData, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return queryRecords(s.collections[entry.Collection], entry.queryFilter(loc), from, to), nil
+}
+
+func (s *MemoryStore) Latest(loc PoliticalGeo) ([]CDSData, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return latestRecords(s.collections[entry.Collection], entry.queryFilter(loc)), nil
+}
+
+// Records returns a copy of records of a collection
+func (s *MemoryStore) Records(collection string) []CDSData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CDSData{}, s.collections[collection]...)
+}
+
+func (s *MemoryStore) SaveForecasts(forecasts []Forecast) (UpsertResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, result := upsertForecasts(s.forecasts, forecasts)
+	s.forecasts = stored
+	return result, nil
+}
+
+func (s *MemoryStore) Forecasts(loc PoliticalGeo, from int64, to int64) ([]Forecast, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return queryForecasts(s.forecasts, forecastFilter(loc), from, to), nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// upsertRecords replaces stored records by name and report_ts and appends the missing ones
+func upsertRecords(stored []CDSData, records []CDSData) ([]CDSData, UpsertResult) {
+	set := newRecordSet(stored)
+	_, result := set.upsert(records)
+	return set.records, result
+}
+
+// recordSet is records unique by name and report_ts with an index of them
+type recordSet struct {
+	records []CDSData
+	index   map[cdsRecordKey]int
+}
+
+// newRecordSet indexes records. A later record of the same name and report_ts replaces the earlier one.
+func newRecordSet(records []CDSData) *recordSet {
+	set := recordSet{records: make([]CDSData, 0, len(records)), index: make(map[cdsRecordKey]int, len(records))}
+	for _, r := range records {
+		key := cdsRecordKey{r.Name, r.ReportTime}
+		if i, ok := set.index[key]; ok {
+			set.records[i] = r
+			continue
+		}
+		set.index[key] = len(set.records)
+		set.records = append(set.records, r)
+	}
+	return &set
+}
+
+// upsert replaces records by name and report_ts and inserts the missing ones, and returns the records inserted or modified
+func (s *recordSet) upsert(records []CDSData) ([]CDSData, UpsertResult) {
+	result := UpsertResult{}
+	changed := []CDSData{}
+	for _, r := range records {
+		key := cdsRecordKey{r.Name, r.ReportTime}
+		i, ok := s.index[key]
+		switch {
+		case !ok:
+			s.index[key] = len(s.records)
+			s.records = append(s.records, r)
+			result.Inserted++
+		case reflect.DeepEqual(s.records[i], r):
+			result.Unchanged++
+			continue
+		default:
+			s.records[i] = r
+			result.Modified++
+		}
+		changed = append(changed, r)
+	}
+	return changed, result
+}
+
+// continuousRecords queries stored records like ContinuousDataCDSConfirm does in Mongo
+func continuousRecords(stored []CDSData, locFilter map[string]string, windowSize int64, timeBefore int64, policy GapPolicy) []CDSScoreDataSet {
+	docs := []CDSScoreDataSet{}
+	for _, r := range stored {
+		if timeBefore > 0 && r.ReportTime > timeBefore {
+			continue
+		}
+		if !matchRecord(r, locFilter) {
+			continue
+		}
+		docs = append(docs, CDSScoreDataSet{Name: r.Name, ReportTime: r.ReportTime, ReportDate: r.ReportTimeDate, Cases: r.Cases, Deaths: r.Deaths, Recovered: r.Recovered, Active: r.Active, Population: r.Population})
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].ReportTime > docs[j].ReportTime
+	})
+	if int64(len(docs)) > windowSize+1 {
+		docs = docs[:windowSize+1]
+	}
+	return continuousDelta(docs, windowSize, policy)
+}
+
+// queryRecords queries stored records like QueryCDSConfirm does in Mongo
+func queryRecords(stored []CDSData, filter map[string]string, from int64, to int64) []CDSData {
+	records := []CDSData{}
+	for _, r := range stored {
+		if r.ReportTime < from || (to > 0 && r.ReportTime > to) || !matchRecord(r, filter) {
+			continue
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return records[i].ReportTime < records[j].ReportTime
+	})
+	return records
+}
+
+// latestRecords queries stored records like LatestCDSConfirm does in Mongo
+func latestRecords(stored []CDSData, filter map[string]string) []CDSData {
+	latest := map[string]CDSData{}
+	for _, r := range stored {
+		if !matchRecord(r, filter) {
+			continue
+		}
+		if l, ok := latest[r.Name]; !ok || r.ReportTime > l.ReportTime {
+			latest[r.Name] = r
+		}
+	}
+	records := []CDSData{}
+	for _, r := range latest {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Name < records[j].Name
+	})
+	return records
+}
+
+// matchRecord reports whether a record has the values of an analysis filter
+func matchRecord(r CDSData, filter map[string]string) bool {
+	for key, value := range filter {
+		switch key {
+		case "state":
+			if r.State != value {
+				return false
+			}
+		case "county":
+			if r.County != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type forecastKey struct {
+	Name       string
+	Model      string
+	ReportTime int64
+	TargetTime int64
+}
+
+// upsertForecasts replaces stored forecasts by name, model, report_ts and target_ts and appends the missing ones
+func upsertForecasts(stored []Forecast, forecasts []Forecast) ([]Forecast, UpsertResult) {
+	result := UpsertResult{}
+	index := make(map[forecastKey]int, len(stored))
+	for i, f := range stored {
+		index[forecastKey{f.Name, f.Model, f.ReportTime, f.TargetTime}] = i
+	}
+	for _, f := range forecasts {
+		key := forecastKey{f.Name, f.Model, f.ReportTime, f.TargetTime}
+		i, ok := index[key]
+		switch {
+		case !ok:
+			index[key] = len(stored)
+			stored = append(stored, f)
+			result.Inserted++
+		case reflect.DeepEqual(stored[i], f):
+			result.Unchanged++
+		default:
+			stored[i] = f
+			result.Modified++
+		}
+	}
+	return stored, result
+}
+
+// queryForecasts queries stored forecasts like QueryForecasts does in Mongo
+func queryForecasts(stored []Forecast, filter map[string]string, from int64, to int64) []Forecast {
+	forecasts := []Forecast{}
+	for _, f := range stored {
+		if f.ReportTime < from || (to > 0 && f.ReportTime > to) {
+			continue
+		}
+		if f.Country != filter["country"] || ("" != filter["state"] && f.State != filter["state"]) || ("" != filter["county"] && f.County != filter["county"]) {
+			continue
+		}
+		forecasts = append(forecasts, f)
+	}
+	sort.Slice(forecasts, func(i, j int) bool {
+		a, b := forecasts[i], forecasts[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.ReportTime != b.ReportTime {
+			return a.ReportTime < b.ReportTime
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		return a.TargetTime < b.TargetTime
+	})
+	return forecasts
+}
@@ -3,10 +3,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/bitmark-inc/autonomy-api/schema"
@@ -15,14 +15,18 @@ import (
 type CovidSource string
 
 const (
-	layoutISO   = "2006-01-02"
-	httpMaxByte = 5242880
+	layoutISO               = "2006-01-02"
+	layoutCDSDate           = "2006-1-2"
+	httpDailyMaxByte        = 5 << 20 // the daily file is read into memory
+	httpDownloadMaxByte     = 1 << 30 // timeseries-byLocation.json is hundreds of MB, streamed to a file
+	defaultHistoryBatchSize = 1000
 )
 const (
 	CDSDaily                  CovidSource = "dailyFile"
 	CDSDailyHTTP              CovidSource = "dailyHttp"
 	CDSTimeseriesLocationFile CovidSource = "timeSeriesLocationFile"
 	CDSTimeseriesByDateFile   CovidSource = "timeSeriesByDateFile"
+	CDSLocationsFile          CovidSource = "locationsFile"
 )
 
 type CovidParser interface {
@@ -30,11 +34,12 @@ type CovidParser interface {
 }
 
 type CDSParser struct {
-	Country     string
+	Filter      LocationFilter
 	Level       string
 	CDSDataType CovidSource
 	DataFile    *os.File
 	URL         string
+	SourceTime  time.Time // time of the source data if the source has one
 	Result      []CDSData
 }
 
@@ -57,374 +62,277 @@ type CDSData struct {
 	CountyID       string         `json:"countyId" bson:"countyId"`
 	Location       schema.GeoJSON `json:"location" bson:"location"`
 	Timezone       []string       `json:"tz" bson:"tz"`
+	Population     float64        `json:"population" bson:"population"`
 }
 
-func NewCDSParser(source CovidSource, country string, level string, input *os.File, url string) CDSParser {
-	return CDSParser{Country: country, Level: level, CDSDataType: source, DataFile: input, URL: url}
+func NewCDSParser(source CovidSource, filter LocationFilter, level string, input *os.File, url string) CDSParser {
+	return CDSParser{Filter: filter, Level: level, CDSDataType: source, DataFile: input, URL: url}
 }
 
-func (c *CDSParser) ParseHistory(noEarlier int64) (int, int, error) {
+// ParseHistory walks the top-level object of timeseries-byLocation.json one location at a time.
+// Records are handed to emit in batches of batchSize, so the whole file is never held in memory.
+func (c *CDSParser) ParseHistory(noEarlier int64, batchSize int, emit func([]CDSData) error) (int, int, error) {
 	dec := json.NewDecoder(c.DataFile)
 	count := 0
 	rawRecordCount := 0
-	sourceData := make(map[string]interface{})
-	if err := dec.Decode(&sourceData); err != nil {
-		fmt.Println("Decode error :", err)
+	if batchSize <= 0 {
+		batchSize = defaultHistoryBatchSize
+	}
+	if err := expectDelim(dec, '{'); err != nil {
+		log.Println("Decode error :", err)
 		return 0, 0, err
 	}
-	records := []CDSData{}
-	for key, value := range sourceData {
-		m := value.(map[string]interface{})
-		if strings.Contains(key, c.Country) {
-			rawRecordCount++
-			dateData := m["dates"].(map[string]interface{})
-			//fmt.Println("number date objects:", len(dateData))
-			for k, v := range dateData {
-				record := CDSData{}
-				ok := false
-				record.Name, ok = m["name"].(string)
-				if !ok || len(record.Name) <= 0 {
-					fmt.Println("SKIP : Invalid name: ", record.Name)
-					continue
-				}
-				record.Country, _ = m["country"].(string)
-				record.City, _ = m["city"].(string)
-				record.County, _ = m["county"].(string)
-				record.State, _ = m["state"].(string)
-
-				record.Country, ok = m["country"].(string)
-				if !ok || len(record.Country) <= 0 {
-					fmt.Println("SKIP : Invalid country: ", record.Country)
-					continue
-				}
-				record.CountryID, _ = m["countryId"].(string)
-				record.StateID, _ = m["stateId"].(string)
-				record.CountyID, _ = m["countyId"].(string)
-
-				record.Level, ok = m["level"].(string)
-				if ok && "" == record.Level {
-					switch c.Level {
-					case "country":
-						if "" != record.Country && "" == record.State {
-							record.Level = "country"
-						}
-					case "state":
-						if "" != record.State && "" == record.County {
-							record.Level = "state"
-						}
-					case "county":
-						if "" != record.County && "" == record.City {
-							record.Level = "county"
-						}
-					case "city":
-						record.Level = "city"
-					default:
-						fmt.Println("SKIP : Invalid level: ", record.Level)
-						continue
-					}
-				}
-
-				if record.Level != c.Level {
-					fmt.Println("SKIP : Mismatch level: ", record.Level, "/", c.Level)
-					continue
-				}
-
-				coorRaw, ok := m["coordinates"].([]interface{})
-				if ok && len(coorRaw) > 0 {
-					coortemp := []float64{}
-					for _, coorV := range coorRaw {
-						coortemp = append(coortemp, coorV.(float64))
-					}
-					record.Location = schema.GeoJSON{Type: "Point", Coordinates: coortemp}
-				} else {
-					record.Location = schema.GeoJSON{Type: "Point", Coordinates: []float64{}}
-				}
-
-				tzRaw, ok := m["tz"].([]interface{})
-				if ok && len(tzRaw) > 0 {
-					tztemp := []string{}
-					for _, tzV := range tzRaw {
-						tztemp = append(tztemp, tzV.(string))
-					}
-					record.Timezone = tztemp
-				} else {
-					record.Timezone = []string{}
-				}
-
-				dateCases, ok := v.(map[string]interface{})
-				if !ok {
-					fmt.Println("cast date data error")
-					continue
-				}
-				record.Cases, ok = dateCases["cases"].(float64)
-				if !ok {
-					fmt.Println("SKIP : Get cases fail")
-					continue
-				}
-				record.Deaths, _ = dateCases["deaths"].(float64)
-				if record.Deaths < 0 {
-					record.Deaths = 0
-				}
-				record.Recovered, _ = dateCases["recovered"].(float64)
-				if record.Recovered < 0 {
-					record.Recovered = 0
-				}
-				record.Active, _ = dateCases["active"].(float64)
-				if record.Active <= 0 {
-					record.Active = record.Cases - record.Deaths - record.Recovered
-				}
-
-				dateBeginUTCTime, err := convertDateToUTCTime(k)
-				if err != nil {
-					fmt.Println("SKIP :onvert date string to UTC time error:", err)
-					continue
-				}
-
-				record.ReportTime = dateBeginUTCTime
-				record.UpdateTime = time.Now().UTC().Unix()
-				record.ReportTimeDate = k
-				if record.ReportTime >= noEarlier {
-					records = append(records, record)
-					count++
+	batch := make([]CDSData, 0, batchSize)
+	for dec.More() {
+		keyToken, err := dec.Token()
+		if err != nil {
+			return count, rawRecordCount, err
+		}
+		key, ok := keyToken.(string)
+		if !ok {
+			return count, rawRecordCount, fmt.Errorf("invalid location key %v", keyToken)
+		}
+		loc := CDSLocation{}
+		if err := dec.Decode(&loc); err != nil {
+			log.Println("Decode error :", err)
+			return count, rawRecordCount, fmt.Errorf("decode location %s: %v", key, err)
+		}
+		if !c.Filter.Match(loc) {
+			continue
+		}
+		rawRecordCount++
+		for _, record := range c.historyRecords(loc, noEarlier) {
+			batch = append(batch, record)
+			count++
+			if len(batch) >= batchSize {
+				if err := emit(batch); err != nil {
+					return count, rawRecordCount, err
 				}
-			} // end of parsing date objects
+				batch = make([]CDSData, 0, batchSize)
+			}
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return count, rawRecordCount, err
+	}
+	if len(batch) > 0 {
+		if err := emit(batch); err != nil {
+			return count, rawRecordCount, err
 		}
 	}
-	c.Result = records
-
 	return count, rawRecordCount, nil
 }
 
-func convertDateToUTCTime(date string) (int64, error) {
-	t, parseErr := time.Parse(layoutISO, date)
-	if parseErr != nil {
-		return 0, parseErr
+// ParseHistoryByDate walks the top-level object of timeseries-byDate.json one date at a time.
+// Locations in the file are referenced by their index in locations.json, which is read from locationFile.
+// Records are handed to emit in batches of batchSize.
+func (c *CDSParser) ParseHistoryByDate(locationFile *os.File, noEarlier int64, batchSize int, emit func([]CDSData) error) (int, int, error) {
+	count := 0
+	if batchSize <= 0 {
+		batchSize = defaultHistoryBatchSize
 	}
-	return t.Unix(), nil
-}
-
-func convertLocalDateToUTC(tz string, date string) (int64, error) {
-	location, err := time.LoadLocation(tz)
-	if err != nil {
-		fmt.Errorf("loadLocation error:%v and use UTC instead", err)
-		t, parseErr := time.Parse(layoutISO, date)
-		if parseErr != nil {
-			return 0, parseErr
-		}
-		return t.Unix(), nil
+	locations := []CDSLocation{}
+	if err := json.NewDecoder(locationFile).Decode(&locations); err != nil {
+		log.Println("Decode locations error :", err)
+		return 0, 0, fmt.Errorf("decode locations: %v", err)
 	}
-	t, parseErr := time.ParseInLocation(layoutISO, date, location)
-	if parseErr != nil {
-		return 0, parseErr
+	selected := map[string]CDSLocation{}
+	for idx, loc := range locations {
+		if c.Filter.Match(loc) {
+			selected[strconv.Itoa(idx)] = loc
+		}
 	}
-	return t.UTC().Unix(), nil
-}
+	rawRecordCount := len(selected)
 
-func (c *CDSParser) ParseDaily() (int, error) {
 	dec := json.NewDecoder(c.DataFile)
-	count := 0
-	updateRecords := []CDSData{}
-
-	sourceData := make([]interface{}, 0)
-	if err := dec.Decode(&sourceData); err != nil {
-		return 0, err
+	if err := expectDelim(dec, '{'); err != nil {
+		log.Println("Decode error :", err)
+		return 0, rawRecordCount, err
 	}
-	for _, value := range sourceData {
-		record := CDSData{}
-		object := value.(map[string]interface{})
-		name, ok := object["name"].(string)
-		if ok && len(name) > 0 && strings.Contains(name, c.Country) { // Country
-			record.Name = name
-		} else {
+	batch := make([]CDSData, 0, batchSize)
+	for dec.More() {
+		keyToken, err := dec.Token()
+		if err != nil {
+			return count, rawRecordCount, err
+		}
+		key, ok := keyToken.(string)
+		if !ok {
+			return count, rawRecordCount, fmt.Errorf("invalid date key %v", keyToken)
+		}
+		skipDate := false
+		date, err := normalizeCDSDate(key)
+		if err != nil {
+			log.Println("SKIP : Invalid date: ", key)
+			skipDate = true
+		} else if reportTime, _ := convertDateToUTCTime(date); reportTime < noEarlier {
+			skipDate = true
+		}
+		if skipDate {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return count, rawRecordCount, err
+			}
 			continue
 		}
-		record.City, _ = object["city"].(string)
-		record.Country, _ = object["country"].(string)
-		record.County, _ = object["county"].(string)
-		record.State, _ = object["state"].(string)
-		record.CountryID, _ = object["countryId"].(string)
-		record.StateID, _ = object["stateId"].(string)
-		record.CountyID, _ = object["countyId"].(string)
-
-		if ok && "" == record.Level {
-			switch c.Level {
-			case "country":
-				if "" != record.Country && "" == record.State {
-					record.Level = "country"
-				}
-			case "state":
-				if "" != record.State && "" == record.County {
-					record.Level = "state"
-				}
-			case "county":
-				if "" != record.County && "" == record.City {
-					record.Level = "county"
-				}
-			case "city":
-				record.Level = "city"
-			default:
+		dateData := make(map[string]CDSCounts)
+		if err := dec.Decode(&dateData); err != nil {
+			log.Println("Decode error :", err)
+			return count, rawRecordCount, fmt.Errorf("decode date %s: %v", key, err)
+		}
+		for idx, loc := range selected {
+			counts, ok := dateData[idx]
+			if !ok {
+				continue
+			}
+			record, err := newCDSRecord(loc, counts, c.Level, date)
+			if err != nil {
+				log.Println("SKIP :", err)
 				continue
 			}
+			batch = append(batch, record)
+			count++
+			if len(batch) >= batchSize {
+				if err := emit(batch); err != nil {
+					return count, rawRecordCount, err
+				}
+				batch = make([]CDSData, 0, batchSize)
+			}
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return count, rawRecordCount, err
+	}
+	if len(batch) > 0 {
+		if err := emit(batch); err != nil {
+			return count, rawRecordCount, err
 		}
+	}
+	return count, rawRecordCount, nil
+}
 
-		if record.Level != c.Level {
+// normalizeCDSDate converts a CDS date key like 2020-3-1 to layoutISO
+func normalizeCDSDate(date string) (string, error) {
+	t, err := time.Parse(layoutCDSDate, date)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layoutISO), nil
+}
+
+// historyRecords converts dates of a location to records which report no earlier than noEarlier
+func (c *CDSParser) historyRecords(loc CDSLocation, noEarlier int64) []CDSData {
+	records := []CDSData{}
+	for date, counts := range loc.Dates {
+		record, err := newCDSRecord(loc, counts, c.Level, date)
+		if err != nil {
+			log.Println("SKIP :", err)
 			continue
 		}
-
-		coorRaw, ok := object["coordinates"].([]interface{})
-		if ok && len(coorRaw) > 0 {
-			coortemp := []float64{}
-			for _, coorV := range coorRaw {
-				coortemp = append(coortemp, coorV.(float64))
-			}
-			record.Location = schema.GeoJSON{Type: "Point", Coordinates: coortemp}
-		} else {
-			record.Location = schema.GeoJSON{Type: "Point", Coordinates: []float64{}}
+		if record.ReportTime >= noEarlier {
+			records = append(records, record)
 		}
+	}
+	return records
+}
 
-		tzRaw, ok := object["tz"].([]interface{})
-		if ok && len(tzRaw) > 0 {
-			tztemp := []string{}
-			for _, tzV := range tzRaw {
-				tztemp = append(tztemp, tzV.(string))
-			}
-			record.Timezone = tztemp
-		} else {
-			record.Timezone = []string{}
-		}
-		record.Cases, ok = object["cases"].(float64)
-		if !ok {
-			fmt.Println("cast cases error")
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expect %v but get %v", delim, t)
+	}
+	return nil
+}
+
+func convertDateToUTCTime(date string) (int64, error) {
+	t, parseErr := time.Parse(layoutISO, date)
+	if parseErr != nil {
+		return 0, parseErr
+	}
+	return t.Unix(), nil
+}
+
+// parseDateRange returns report_ts of the dates from and to, which are optional. A date which is not given is 0.
+func parseDateRange(from string, to string) (int64, int64, error) {
+	times := [2]int64{}
+	for i, date := range []string{from, to} {
+		if "" == date {
 			continue
 		}
-		record.Deaths, _ = object["deaths"].(float64)
-		if record.Deaths < 0 {
-			record.Deaths = 0
-		}
-		record.Recovered, _ = object["recovered"].(float64)
-		if record.Recovered < 0 {
-			record.Recovered = 0
+		t, err := convertDateToUTCTime(date)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s %s, want date like 2020-04-20", []string{"from", "to"}[i], date)
 		}
-		record.Active, _ = object["active"].(float64)
-		if record.Active <= 0 {
-			record.Active = record.Cases - record.Deaths - record.Recovered
+		times[i] = t
+	}
+	return times[0], times[1], nil
+}
+
+// convertUTCToLocalDate returns the date of t in the first timezone of tz, which is the report date of a location at t.
+// UTC is used when tz is empty or unknown.
+func convertUTCToLocalDate(tz []string, t time.Time) string {
+	location := time.UTC
+	if len(tz) > 0 {
+		l, err := time.LoadLocation(tz[0])
+		if err != nil {
+			log.Printf("loadLocation error:%v and use UTC instead\n", err)
+		} else {
+			location = l
 		}
+	}
+	return t.In(location).Format(layoutISO)
+}
 
-		year, month, day := time.Now().Date()
-		dateString := fmt.Sprintf("%d-%.2d-%.2d", year, int(month), day)
-		record.UpdateTime = time.Now().UTC().Unix()
-		record.ReportTime = time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix()
-		record.ReportTimeDate = dateString //In local time
-		count++
-		updateRecords = append(updateRecords, record)
+func (c *CDSParser) ParseDaily() (int, error) {
+	dec := json.NewDecoder(c.DataFile)
+	sourceData := []CDSDailyLocation{}
+	if err := dec.Decode(&sourceData); err != nil {
+		return 0, fmt.Errorf("decode daily data: %v", err)
 	}
-	c.Result = updateRecords
-	return count, nil
+	c.Result = c.dailyRecords(sourceData)
+	return len(c.Result), nil
 }
 
 func (c *CDSParser) ParseDailyOnline() (int, error) {
-	resp, err := http.Get(c.URL)
+	data, header, err := NewFetcher(httpDailyMaxByte, dailyMaxByteKey).ReadAll(c.URL)
 	if err != nil {
-		fmt.Println("ParseDailyOnline error:", err)
+		log.Println("ParseDailyOnline error:", err)
 		return 0, err
 	}
-	defer resp.Body.Close()
-	count := 0
-	updateRecords := []CDSData{}
-	sourceData := make([]interface{}, 0)
-	data, err := ioutil.ReadAll(resp.Body)
+	if lastModified, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+		c.SourceTime = lastModified
+	}
+	sourceData := []CDSDailyLocation{}
 	err = json.Unmarshal(data, &sourceData)
 	if err != nil {
-		fmt.Println("ParseDailyOnline error:", err)
-		return 0, err
+		log.Println("ParseDailyOnline error:", err)
+		return 0, fmt.Errorf("decode daily data: %v", err)
 	}
+	c.Result = c.dailyRecords(sourceData)
+	return len(c.Result), nil
+}
 
-	for _, value := range sourceData {
-		record := CDSData{}
-		object := value.(map[string]interface{})
-		name, ok := object["name"].(string)
-		if ok && len(name) > 0 && strings.Contains(name, c.Country) { // Country
-			record.Name = name
-		} else {
-			continue
-		}
-		record.City, _ = object["city"].(string)
-		record.Country, _ = object["country"].(string)
-		record.County, _ = object["county"].(string)
-		record.State, _ = object["state"].(string)
-		record.CountryID, _ = object["countryId"].(string)
-		record.StateID, _ = object["stateId"].(string)
-		record.CountyID, _ = object["countyId"].(string)
-
-		record.Level, ok = object["level"].(string)
-
-		if ok && "" == record.Level {
-			switch c.Level {
-			case "country":
-				record.Level = "country"
-			case "state":
-				record.Level = "state"
-			case "county":
-				record.Level = "county"
-			case "city":
-				record.Level = "city"
-			}
-			fmt.Println("level set to:", record.Level)
-		}
-
-		if record.Level != c.Level {
+// dailyRecords converts daily locations which match the parser to records.
+// The report date of a location is the date of the source time, or now when the source has no time, in the location's timezone.
+// Like history, report_ts is the start of the report date in UTC, so daily and history records of a date line up.
+func (c *CDSParser) dailyRecords(sourceData []CDSDailyLocation) []CDSData {
+	at := c.SourceTime
+	if at.IsZero() {
+		at = time.Now()
+	}
+	updateRecords := []CDSData{}
+	for _, loc := range sourceData {
+		if len(loc.Name) <= 0 || !c.Filter.Match(loc.CDSLocation) {
 			continue
 		}
-
-		coorRaw, ok := object["coordinates"].([]interface{})
-		if ok && len(coorRaw) > 0 {
-			coortemp := []float64{}
-			for _, coorV := range coorRaw {
-				coortemp = append(coortemp, coorV.(float64))
-			}
-			record.Location = schema.GeoJSON{Type: "Point", Coordinates: coortemp}
-		} else {
-			record.Location = schema.GeoJSON{Type: "Point", Coordinates: []float64{}}
-		}
-
-		tzRaw, ok := object["tz"].([]interface{})
-		if ok && len(tzRaw) > 0 {
-			tztemp := []string{}
-			for _, tzV := range tzRaw {
-				tztemp = append(tztemp, tzV.(string))
-			}
-			record.Timezone = tztemp
-		} else {
-			record.Timezone = []string{}
-		}
-		record.Cases, ok = object["cases"].(float64)
-		if !ok {
-			fmt.Println(record.Name, " has cast cases error! data:", object["cases"])
+		dateString := convertUTCToLocalDate(loc.Timezone, at)
+		record, err := newCDSRecord(loc.CDSLocation, loc.CDSCounts, c.Level, dateString)
+		if err != nil {
 			continue
 		}
-		record.Deaths, _ = object["deaths"].(float64)
-		if record.Deaths < 0 {
-			record.Deaths = 0
-		}
-		record.Recovered, _ = object["recovered"].(float64)
-		if record.Recovered < 0 {
-			record.Recovered = 0
-		}
-		record.Active, _ = object["active"].(float64)
-		if record.Active <= 0 {
-			record.Active = record.Cases - record.Deaths - record.Recovered
-		}
-
-		year, month, day := time.Now().Date()
-		dateString := fmt.Sprintf("%d-%.2d-%.2d", year, int(month), day)
-		record.UpdateTime = time.Now().UTC().Unix()
-		record.ReportTime = time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix()
-		record.ReportTimeDate = dateString //In local time
-		//fmt.Println("report:", record.ReportTime, "  date:", record.ReportTimeDate, " updateTime:", record.UpdateTime)
-		count++
 		updateRecords = append(updateRecords, record)
 	}
-	c.Result = updateRecords
-
-	return count, nil
+	return updateRecords
 }
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"testing"
+	"time"
+)
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open(path.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func fixtureParser(t *testing.T, source CovidSource, file string, country string, state string, county string) CDSParser {
+	t.Helper()
+	entry, err := registry.Lookup(country)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f *os.File
+	if "" != file {
+		f = openFixture(t, file)
+		t.Cleanup(func() { f.Close() })
+	}
+	return NewCDSParser(source, entry.locationFilter(state, county), entry.Level, f, "")
+}
+
+func recordNames(records []CDSData) []string {
+	names := map[string]bool{}
+	for _, r := range records {
+		names[r.Name] = true
+	}
+	result := []string{}
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseHistory(t *testing.T) {
+	cases := []struct {
+		name      string
+		country   string
+		state     string
+		county    string
+		count     int
+		locations []string
+	}{
+		{"us counties", CdsUSA, "", "", 60, []string{"Alameda County, California, United States", "King County, Washington, United States", "Santa Clara County, California, United States"}},
+		{"us state filter", CdsUSA, "California", "", 40, []string{"Alameda County, California, United States", "Santa Clara County, California, United States"}},
+		{"us county filter", CdsUSA, "California", "Santa Clara County", 20, []string{"Santa Clara County, California, United States"}},
+		{"taiwan exact country", CdsTaiwan, "", "", 19, []string{"Taiwan"}},
+		{"iceland", CdsIceland, "", "", 20, []string{"Iceland"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			parser := fixtureParser(t, CDSTimeseriesLocationFile, "timeseries-byLocation.json", c.country, c.state, c.county)
+			records := []CDSData{}
+			cnt, _, err := parser.ParseHistory(0, 7, func(batch []CDSData) error {
+				if len(batch) > 7 {
+					t.Errorf("batch size %d is larger than 7", len(batch))
+				}
+				records = append(records, batch...)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cnt != c.count || len(records) != c.count {
+				t.Errorf("count %d records %d, want %d", cnt, len(records), c.count)
+			}
+			if names := recordNames(records); !equalStrings(names, c.locations) {
+				t.Errorf("locations %v, want %v", names, c.locations)
+			}
+		})
+	}
+}
+
+func TestParseHistoryNoEarlier(t *testing.T) {
+	parser := fixtureParser(t, CDSTimeseriesLocationFile, "timeseries-byLocation.json", CdsIceland, "", "")
+	noEarlier, _ := convertDateToUTCTime("2020-04-15")
+	records := []CDSData{}
+	cnt, _, err := parser.ParseHistory(noEarlier, 0, func(batch []CDSData) error {
+		records = append(records, batch...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != 6 {
+		t.Errorf("count %d, want 6", cnt)
+	}
+	for _, r := range records {
+		if r.ReportTime < noEarlier {
+			t.Errorf("record of %s is earlier than 2020-04-15", r.ReportTimeDate)
+		}
+		if r.Population != 364134 {
+			t.Errorf("population %f, want 364134", r.Population)
+		}
+	}
+}
+
+func TestParseHistoryDecodeError(t *testing.T) {
+	f, err := ioutil.TempFile("", "cds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.WriteString(`{"Iceland": {"name": "Iceland", "country": "Iceland", "coordinates": ["north"], "dates": {}}}`)
+	f.Seek(0, 0)
+	entry, _ := registry.Lookup(CdsIceland)
+	parser := NewCDSParser(CDSTimeseriesLocationFile, entry.locationFilter("", ""), entry.Level, f, "")
+	_, _, err = parser.ParseHistory(0, 0, func([]CDSData) error { return nil })
+	if err == nil {
+		t.Fatal("expect decode error of coordinates")
+	}
+}
+
+func TestParseHistoryByDate(t *testing.T) {
+	parser := fixtureParser(t, CDSTimeseriesByDateFile, "timeseries-byDate.json", CdsUSA, "California", "")
+	locations := openFixture(t, "locations.json")
+	defer locations.Close()
+	records := []CDSData{}
+	cnt, locationCount, err := parser.ParseHistoryByDate(locations, 0, 0, func(batch []CDSData) error {
+		records = append(records, batch...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != 40 {
+		t.Errorf("count %d, want 40", cnt)
+	}
+	// California state is matched by the filter but skipped by level
+	if locationCount != 3 {
+		t.Errorf("matched locations %d, want 3", locationCount)
+	}
+	want := []string{"Alameda County, California, United States", "Santa Clara County, California, United States"}
+	if names := recordNames(records); !equalStrings(names, want) {
+		t.Errorf("locations %v, want %v", names, want)
+	}
+	for _, r := range records {
+		if r.ReportTimeDate < "2020-04-01" || len(r.ReportTimeDate) != len(layoutISO) {
+			t.Errorf("invalid report date %s", r.ReportTimeDate)
+		}
+	}
+}
+
+func TestParseDaily(t *testing.T) {
+	parser := fixtureParser(t, CDSDaily, "dataDaily.json", CdsTaiwan, "", "")
+	parser.SourceTime = time.Date(2020, 4, 20, 20, 0, 0, 0, time.UTC)
+	cnt, err := parser.ParseDaily()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != 1 || parser.Result[0].Name != "Taiwan" {
+		t.Fatalf("result %+v, want Taiwan only", parser.Result)
+	}
+	r := parser.Result[0]
+	if r.ReportTimeDate != "2020-04-21" {
+		t.Errorf("report date %s, want 2020-04-21 in Asia/Taipei", r.ReportTimeDate)
+	}
+	if reportTime, _ := convertDateToUTCTime("2020-04-21"); r.ReportTime != reportTime {
+		t.Errorf("report time %d, want %d", r.ReportTime, reportTime)
+	}
+	if r.Active != r.Cases-r.Deaths-r.Recovered {
+		t.Errorf("active %f, want cases - deaths - recovered", r.Active)
+	}
+}
+
+func TestParseDailyOnline(t *testing.T) {
+	data, err := ioutil.ReadFile(path.Join("testdata", "dataDaily.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", "Mon, 20 Apr 2020 20:00:00 GMT")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	entry, _ := registry.Lookup(CdsUSA)
+	parser := NewCDSParser(CDSDaily, entry.locationFilter("", ""), entry.Level, nil, server.URL)
+	cnt, err := parser.ParseDailyOnline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt != 3 {
+		t.Errorf("count %d, want 3 counties", cnt)
+	}
+	for _, r := range parser.Result {
+		if r.ReportTimeDate != "2020-04-20" {
+			t.Errorf("%s report date %s, want 2020-04-20 in America/Los_Angeles", r.Name, r.ReportTimeDate)
+		}
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	from, to, err := parseDateRange("2020-04-01", "2020-04-20")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if from != time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC).Unix() || to != time.Date(2020, 4, 20, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("parseDateRange = %d, %d", from, to)
+	}
+	if _, _, err := parseDateRange("2020-04-01", "20-04-2020"); nil == err {
+		t.Error("parseDateRange accepted a malformed to date")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+const (
+	perCapitaBase = 100000
+	// perCapitaDays is the number of days of the longest per-capita metric, which analysis queries whatever its window is
+	perCapitaDays = 2 * daysOfWeek
+)
+
+// PerCapita is incidence of a window per 100k population, so locations of different sizes are comparable
+type PerCapita struct {
+	Population     float64 `json:"population"`
+	CasesPer100k7  float64 `json:"cases_per_100k_7d"`   // new cases of the last 7 days per 100k
+	CasesPer100k14 float64 `json:"cases_per_100k_14d"`  // new cases of the last 14 days per 100k
+	DeathsPer100k  float64 `json:"deaths_per_100k_14d"` // new deaths of the last 14 days per 100k
+}
+
+// perCapitaOf computes incidence of daily new cases and deaths sorted by report_ts in ascending order.
+// Metrics are 0 when the population is unknown.
+func perCapitaOf(data []CDSScoreDataSet) PerCapita {
+	if 0 == len(data) {
+		return PerCapita{}
+	}
+	p := PerCapita{Population: data[len(data)-1].Population}
+	if p.Population <= 0 {
+		return p
+	}
+	cases7, _ := sumLastDays(data, daysOfWeek)
+	cases14, deaths14 := sumLastDays(data, perCapitaDays)
+	p.CasesPer100k7 = cases7 / p.Population * perCapitaBase
+	p.CasesPer100k14 = cases14 / p.Population * perCapitaBase
+	p.DeathsPer100k = deaths14 / p.Population * perCapitaBase
+	return p
+}
+
+// sumLastDays sums new cases and deaths of the last days of data
+func sumLastDays(data []CDSScoreDataSet, days int) (float64, float64) {
+	if len(data) < days {
+		days = len(data)
+	}
+	cases := float64(0)
+	deaths := float64(0)
+	for _, d := range data[len(data)-days:] {
+		cases += d.Cases
+		deaths += d.Deaths
+	}
+	return cases, deaths
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// serial interval of COVID-19 of Nishiura et al. 2020
+	defaultSIMean = 4.7
+	defaultSISD   = 2.9
+	// defaultRtWindow is the number of days Rt of a day is assumed constant over
+	defaultRtWindow = 7
+	// rtHistoryDays is the number of days of daily new cases an estimation reads
+	rtHistoryDays = 365
+	// gamma prior of Rt of Cori et al. 2013, with mean 5 and sd 5
+	rtPriorShape = 1.0
+	rtPriorScale = 5.0
+	// credible interval of Rt is between the quantiles
+	rtLowerQuantile = 0.025
+	rtUpperQuantile = 0.975
+	// a discretized gamma serial interval is cut where its cumulative probability reaches siCutoff, or at siMaxDays
+	siCutoff  = 0.999
+	siMaxDays = 30
+)
+
+// SerialInterval is the probability of the days between the symptom onsets of an infector and an infectee.
+// Index s is the probability of s+1 days, and probabilities sum to 1.
+type SerialInterval []float64
+
+// GammaSerialInterval discretizes a gamma distribution of mean and sd to days. The probability of day 0 is added to day 1.
+func GammaSerialInterval(mean, sd float64) (SerialInterval, error) {
+	if mean <= 0 || sd <= 0 {
+		return nil, fmt.Errorf("invalid serial interval mean %v sd %v", mean, sd)
+	}
+	shape := (mean / sd) * (mean / sd)
+	scale := sd * sd / mean
+	si := SerialInterval{}
+	prev := 0.0
+	for day := 1; day <= siMaxDays; day++ {
+		cdf := gammaP(shape, (float64(day)+0.5)/scale)
+		si = append(si, cdf-prev)
+		prev = cdf
+		if cdf >= siCutoff {
+			break
+		}
+	}
+	return si.normalize()
+}
+
+// ParseSerialInterval returns the serial interval of comma separated weights of day 1, 2, ... Weights are normalized to sum to 1.
+func ParseSerialInterval(weights string) (SerialInterval, error) {
+	si := SerialInterval{}
+	for _, w := range strings.Split(weights, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(w), 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid serial interval weight %s", w)
+		}
+		si = append(si, v)
+	}
+	return si.normalize()
+}
+
+// NewSerialInterval returns the serial interval of weights, or the gamma serial interval of mean and sd when weights is empty
+func NewSerialInterval(mean, sd float64, weights string) (SerialInterval, error) {
+	if "" != weights {
+		return ParseSerialInterval(weights)
+	}
+	return GammaSerialInterval(mean, sd)
+}
+
+func (si SerialInterval) normalize() (SerialInterval, error) {
+	sum := 0.0
+	for _, w := range si {
+		sum += w
+	}
+	if sum <= 0 {
+		return nil, fmt.Errorf("serial interval %v has no probability", []float64(si))
+	}
+	normalized := make(SerialInterval, len(si))
+	for i, w := range si {
+		normalized[i] = w / sum
+	}
+	return normalized, nil
+}
+
+// RtEstimate is the posterior of the reproduction number of a day, with the location and date columns of CDSDataPoint
+type RtEstimate struct {
+	Name       string  `json:"name"`
+	ReportTime int64   `json:"report_ts"`
+	ReportDate string  `json:"report_date"`
+	Mean       float64 `json:"rt_mean"`
+	Lower      float64 `json:"rt_lower"`   // 2.5% quantile
+	Upper      float64 `json:"rt_upper"`   // 97.5% quantile
+	Cases      float64 `json:"cases"`      // new cases of the day
+	GapPoints  int     `json:"gap_points"` // number of days of the window interpolated over missing days
+	Country    string  `json:"country"`
+	State      string  `json:"state"`
+	County     string  `json:"county"`
+	Level      string  `json:"level"`
+}
+
+// EstimateRt estimates Rt of each day of daily new cases sorted by report_ts in ascending order with the renewal equation method of Cori et al. 2013.
+// Rt of a day is assumed constant over the window of days ending on it, and its posterior is a gamma distribution.
+// Days before a full window, and days without infectious cases before them, have no estimate. Negative new cases count as 0.
+// Estimates are sorted by report_ts in ascending order and have no location.
+func EstimateRt(data []CDSScoreDataSet, si SerialInterval, window int) []RtEstimate {
+	if window < 1 {
+		window = 1
+	}
+	incidence := make([]float64, len(data))
+	for i, d := range data {
+		incidence[i] = math.Max(d.Cases, 0)
+	}
+	// infectiousness of day t is new cases of the days before weighted by the serial interval
+	infectiousness := make([]float64, len(data))
+	for t := range data {
+		for s := 1; s <= len(si) && s <= t; s++ {
+			infectiousness[t] += incidence[t-s] * si[s-1]
+		}
+	}
+	estimates := []RtEstimate{}
+	for t := window; t < len(data); t++ {
+		cases, lambda := 0.0, 0.0
+		gaps := 0
+		for k := t - window + 1; k <= t; k++ {
+			cases += incidence[k]
+			lambda += infectiousness[k]
+			if data[k].Gap {
+				gaps++
+			}
+		}
+		if lambda <= 0 {
+			continue
+		}
+		shape := rtPriorShape + cases
+		scale := 1 / (1/rtPriorScale + lambda)
+		estimates = append(estimates, RtEstimate{
+			Name:       data[t].Name,
+			ReportTime: data[t].ReportTime,
+			ReportDate: data[t].ReportDate,
+			Mean:       shape * scale,
+			Lower:      gammaQuantile(shape, rtLowerQuantile) * scale,
+			Upper:      gammaQuantile(shape, rtUpperQuantile) * scale,
+			Cases:      incidence[t],
+			GapPoints:  gaps,
+		})
+	}
+	return estimates
+}
+
+// RtSeries estimates Rt of each day of a location over the last rtHistoryDays days.
+// Missing days are always interpolated, as the renewal equation needs new cases of every day, and CorrectionDrop is taken as CorrectionClamp for the same reason.
+// Estimates are sorted by report_ts in descending order like ScoreSeries.
+func RtSeries(store Store, loc PoliticalGeo, si SerialInterval, window int, strategy CorrectionStrategy) ([]RtEstimate, error) {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return nil, ErrNoConfirmDataset
+	}
+	contData, err := store.ContinuousData(loc, rtHistoryDays, latestReportAt(), GapInterpolate)
+	if err != nil {
+		return nil, err
+	}
+	if CorrectionDrop == strategy {
+		strategy = CorrectionClamp
+	}
+	estimates := EstimateRt(cleanCorrections(contData, strategy), si, window)
+	sort.Slice(estimates, func(i, j int) bool {
+		return estimates[i].ReportTime > estimates[j].ReportTime
+	})
+	for i := range estimates {
+		estimates[i].Country = loc.Country
+		estimates[i].State = loc.State
+		estimates[i].County = loc.County
+		estimates[i].Level = entry.Level
+	}
+	return estimates, nil
+}
+
+// RtOfAllTime estimates Rt of a location and exports the estimates in format to out.
+// When out is empty, the file is named by the name and date of the latest estimate, ie. data/Taiwan-rt-2020-04-20.csv.
+func RtOfAllTime(store Store, loc PoliticalGeo, si SerialInterval, window int, strategy CorrectionStrategy, format string, out string) error {
+	estimates, err := RtSeries(store, loc, si, window, strategy)
+	if err != nil {
+		return err
+	}
+	if 0 == len(estimates) && "" == out {
+		log.Println("no Rt estimate to export")
+		return nil
+	}
+	name := ""
+	if len(estimates) > 0 {
+		name = estimates[0].Name + "-rt-" + estimates[0].ReportDate
+	}
+	written, err := ExportTable(RtTable(estimates), format, out, name)
+	if err != nil {
+		return err
+	}
+	log.Println("write", len(estimates), "Rt estimates to", written)
+	return nil
+}
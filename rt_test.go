@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"path"
+	"testing"
+)
+
+func TestSerialInterval(t *testing.T) {
+	si, err := NewSerialInterval(defaultSIMean, defaultSISD, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, mean := 0.0, 0.0
+	for i, w := range si {
+		sum += w
+		mean += float64(i+1) * w
+	}
+	if !almostEqual(sum, 1) || math.Abs(mean-defaultSIMean) > 0.2 {
+		t.Errorf("serial interval %v sums to %v with mean %v", si, sum, mean)
+	}
+	si, err = NewSerialInterval(defaultSIMean, defaultSISD, "0, 1, 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(si) != 3 || si[0] != 0 || !almostEqual(si[1], 0.25) || !almostEqual(si[2], 0.75) {
+		t.Errorf("serial interval %v, want 0,0.25,0.75", si)
+	}
+	for _, weights := range []string{"0,0", "1,x", "1,-1"} {
+		if _, err := ParseSerialInterval(weights); err == nil {
+			t.Errorf("expect error of %q", weights)
+		}
+	}
+	if _, err := GammaSerialInterval(0, 1); err == nil {
+		t.Error("expect error of mean 0")
+	}
+}
+
+func TestEstimateRt(t *testing.T) {
+	// cases double every day and the serial interval is one day, so Rt is 2
+	cases := []float64{}
+	for day := 0; day < 12; day++ {
+		cases = append(cases, 100*math.Pow(2, float64(day)))
+	}
+	estimates := EstimateRt(newCases(cases...), SerialInterval{1}, 7)
+	if len(estimates) != 5 {
+		t.Fatalf("estimates %d, want 5 days after a full window", len(estimates))
+	}
+	for _, e := range estimates {
+		if math.Abs(e.Mean-2) > 0.01 || !(e.Lower < e.Mean && e.Mean < e.Upper) || e.Upper-e.Lower > 0.1 {
+			t.Errorf("estimate %+v, want Rt 2", e)
+		}
+	}
+	if last := estimates[len(estimates)-1]; last.ReportTime != 11*secondsOfDay || last.Cases != cases[11] {
+		t.Errorf("last estimate %+v, want day 11", last)
+	}
+
+	// constant cases keep Rt at 1, and few cases widen the interval
+	si, _ := GammaSerialInterval(defaultSIMean, defaultSISD)
+	many := EstimateRt(constantCases(60, 1000), si, 7)
+	few := EstimateRt(constantCases(60, 5), si, 7)
+	last, lastFew := many[len(many)-1], few[len(few)-1]
+	if math.Abs(last.Mean-1) > 0.01 || lastFew.Upper-lastFew.Lower <= last.Upper-last.Lower {
+		t.Errorf("estimates %+v and %+v, want Rt 1 with a wider interval of few cases", last, lastFew)
+	}
+
+	// no infectious case before the window
+	if estimates := EstimateRt(newCases(0, 0, 0, 0, 5, 3), SerialInterval{1}, 2); len(estimates) != 1 {
+		t.Errorf("estimates %+v, want only the last day", estimates)
+	}
+}
+
+func TestRtOfAllTime(t *testing.T) {
+	dir := useDataDir(t)
+	store := NewMemoryStore()
+	loc := PoliticalGeo{Country: CdsIceland}
+	if err := CDSHistoryToDB(store, path.Join("testdata", "timeseries-byLocation.json"), loc, 0); err != nil {
+		t.Fatal(err)
+	}
+	si, _ := GammaSerialInterval(defaultSIMean, defaultSISD)
+	estimates, err := RtSeries(store, loc, si, defaultRtWindow, CorrectionDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if 0 == len(estimates) || estimates[0].ReportDate != "2020-04-20" || estimates[0].Country != CdsIceland || estimates[0].Level != "country" {
+		t.Fatalf("estimates %+v, want the latest day of Iceland first", estimates)
+	}
+	if err := RtOfAllTime(store, loc, si, defaultRtWindow, CorrectionClamp, FormatCSV, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadFile(path.Join(dir, "Iceland-rt-2020-04-20.csv")); err != nil {
+		t.Error(err)
+	}
+	if _, err := RtSeries(store, PoliticalGeo{Country: "Atlantis"}, si, defaultRtWindow, CorrectionClamp); err != ErrNoConfirmDataset {
+		t.Errorf("error %v, want ErrNoConfirmDataset", err)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	scheduleCheckInterval = time.Minute
+	layoutClock           = "15:04"
+	TaskOK                = "ok"
+	TaskFail              = "fail"
+)
+
+// ScheduleTask runs a job for each of its locations every Every, or once a day at At (UTC)
+type ScheduleTask struct {
+	Name      string             `mapstructure:"name"`
+	Job       string             `mapstructure:"job"`
+	Every     time.Duration      `mapstructure:"every"`     // ie. 6h
+	At        string             `mapstructure:"at"`        // ie. 02:00
+	Locations []ScheduleLocation `mapstructure:"locations"` // every registered country when empty
+	Analysis  bool               `mapstructure:"analysis"`  // run analysis of a location after the job of it succeeds, see analysisJob
+}
+
+type ScheduleLocation struct {
+	Country string `mapstructure:"country"`
+	State   string `mapstructure:"state"`
+	County  string `mapstructure:"county"`
+}
+
+// Schedule is the config of serve. StatusFile keeps the last run of each task, so a restart continues the schedule.
+type Schedule struct {
+	StatusFile string         `mapstructure:"statusFile"`
+	Tasks      []ScheduleTask `mapstructure:"tasks"`
+}
+
+// TaskStatus is the last run of a task
+type TaskStatus struct {
+	LastStart time.Time `json:"last_start"`
+	LastEnd   time.Time `json:"last_end"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// LoadSchedule reads a schedule config file (json/yaml/toml)
+func LoadSchedule(file string) (Schedule, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return Schedule{}, err
+	}
+	schedule := Schedule{}
+	if err := v.Unmarshal(&schedule); err != nil {
+		return Schedule{}, err
+	}
+	if "" == schedule.StatusFile {
+		schedule.StatusFile = path.Join(dataDir, "schedule-status.json")
+	}
+	names := map[string]bool{}
+	for i, task := range schedule.Tasks {
+		if "" == task.Name {
+			task.Name = task.Job
+			schedule.Tasks[i] = task
+		}
+		if err := task.validate(); err != nil {
+			return Schedule{}, err
+		}
+		if names[task.Name] {
+			return Schedule{}, fmt.Errorf("invalid schedule task %s: duplicate name", task.Name)
+		}
+		names[task.Name] = true
+	}
+	return schedule, nil
+}
+
+func (t ScheduleTask) validate() error {
+	if _, ok := downloadJobs[t.Job]; !ok && !storeJobs[t.Job] {
+		return fmt.Errorf("invalid schedule task %s: unknown job %q", t.Name, t.Job)
+	}
+	if _, ok := downloadJobs[t.Job]; ok && t.Analysis {
+		return fmt.Errorf("invalid schedule task %s: no analysis after download job %s", t.Name, t.Job)
+	}
+	if (t.Every > 0) == ("" != t.At) {
+		return fmt.Errorf("invalid schedule task %s: one of every and at is required", t.Name)
+	}
+	if "" != t.At {
+		if _, err := time.Parse(layoutClock, t.At); err != nil {
+			return fmt.Errorf("invalid schedule task %s: invalid at %s", t.Name, t.At)
+		}
+	}
+	return nil
+}
+
+// due tells if the task should run at now, after its last run started at last
+func (t ScheduleTask) due(last time.Time, now time.Time) bool {
+	if last.IsZero() {
+		return true
+	}
+	if t.Every > 0 {
+		return !now.Before(last.Add(t.Every))
+	}
+	return !now.Before(t.nextAt(last))
+}
+
+// nextAt returns the first time of At after after
+func (t ScheduleTask) nextAt(after time.Time) time.Time {
+	clock, _ := time.Parse(layoutClock, t.At)
+	after = after.UTC()
+	next := time.Date(after.Year(), after.Month(), after.Day(), clock.Hour(), clock.Minute(), 0, 0, time.UTC)
+	if !next.After(after) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// locations returns locations of the task. A download job runs once.
+func (t ScheduleTask) locations() []PoliticalGeo {
+	if _, ok := downloadJobs[t.Job]; ok {
+		return []PoliticalGeo{{}}
+	}
+	locs := []PoliticalGeo{}
+	for _, l := range t.Locations {
+		locs = append(locs, PoliticalGeo{Country: l.Country, State: l.State, County: l.County})
+	}
+	if 0 == len(locs) {
+		names := []string{}
+		for name := range registry {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			locs = append(locs, PoliticalGeo{Country: name})
+		}
+	}
+	return locs
+}
+
+// analysisJob returns the analysis job of loc. A location without the state or county its country filters by, ie. United States,
+// has no single data-set, so every location of it is analysed by analysisAll.
+func analysisJob(loc PoliticalGeo) string {
+	entry, err := registry.Lookup(loc.Country)
+	if err != nil {
+		return "analysis"
+	}
+	if _, err := entry.filter(loc); errors.Is(err, ErrNoConfirmDataset) {
+		return "analysisAll"
+	}
+	return "analysis"
+}
+
+// Scheduler runs tasks of a schedule one after another, so runs never overlap.
+// A run which takes longer than the interval of a task delays the next run instead of starting another one.
+type Scheduler struct {
+	Schedule Schedule
+	Status   map[string]TaskStatus
+	// run runs a job of a location
+	run func(job string, loc PoliticalGeo) error
+}
+
+func NewScheduler(schedule Schedule, run func(job string, loc PoliticalGeo) error) (*Scheduler, error) {
+	s := Scheduler{Schedule: schedule, Status: map[string]TaskStatus{}, run: run}
+	data, err := ioutil.ReadFile(schedule.StatusFile)
+	if os.IsNotExist(err) {
+		return &s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.Status); err != nil {
+		return nil, fmt.Errorf("decode schedule status %s: %w", schedule.StatusFile, err)
+	}
+	return &s, nil
+}
+
+// RunDue runs tasks which are due at now and returns the number of runs
+func (s *Scheduler) RunDue(now time.Time) int {
+	runs := 0
+	for _, task := range s.Schedule.Tasks {
+		if !task.due(s.Status[task.Name].LastStart, now) {
+			continue
+		}
+		s.runTask(task, now)
+		runs++
+	}
+	return runs
+}
+
+func (s *Scheduler) runTask(task ScheduleTask, now time.Time) {
+	log.Println("schedule: run", task.Name, "at", now.Format(time.RFC3339))
+	errs := []string{}
+	for _, loc := range task.locations() {
+		err := s.run(task.Job, loc)
+		if err == nil && task.Analysis {
+			err = s.run(analysisJob(loc), loc)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", loc.Country, err))
+		}
+	}
+	status := TaskStatus{LastStart: now, LastEnd: time.Now().UTC(), Status: TaskOK}
+	if len(errs) > 0 {
+		status.Status = TaskFail
+		status.Error = strings.Join(errs, "; ")
+	}
+	log.Println("schedule:", task.Name, status.Status, status.Error)
+	s.Status[task.Name] = status
+	if err := s.saveStatus(); err != nil {
+		log.Println("schedule: save status error:", err)
+	}
+}
+
+// saveStatus writes the status to a temp file and renames it over the status file
+func (s *Scheduler) saveStatus() error {
+	data, err := json.MarshalIndent(s.Status, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(s.Schedule.StatusFile), 0755); err != nil {
+		return err
+	}
+	tmp := s.Schedule.StatusFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Schedule.StatusFile)
+}
+
+// Serve runs due tasks every scheduleCheckInterval until stop is closed. A running task is finished before Serve returns.
+func (s *Scheduler) Serve(stop <-chan struct{}) {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.RunDue(time.Now().UTC())
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serve runs the schedule of -schedule with store until SIGINT or SIGTERM
+func serve(store Store) error {
+	if "" == scheduleFile {
+		return fmt.Errorf("serve needs a schedule file by -schedule")
+	}
+	schedule, err := LoadSchedule(scheduleFile)
+	if err != nil {
+		return fmt.Errorf("load schedule error: %w", err)
+	}
+	scheduler, err := NewScheduler(schedule, func(job string, loc PoliticalGeo) error {
+		if download, ok := downloadJobs[job]; ok {
+			return download()
+		}
+		return runStoreJob(store, job, loc)
+	})
+	if err != nil {
+		return err
+	}
+	var server *APIServer
+	if "" != apiAddr {
+		if server, err = newAPIServer(store); err != nil {
+			return err
+		}
+	}
+	// one handler stops both the schedule and the API, so a second signal kills the running task
+	stop := stopOnSignal()
+	var api sync.WaitGroup
+	if server != nil {
+		api.Add(1)
+		go func() {
+			defer api.Done()
+			if err := serveAPI(server, apiAddr, stop); err != nil {
+				log.Println("api error:", err)
+			}
+		}()
+	}
+	scheduler.Serve(stop)
+	api.Wait()
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func writeSchedule(t *testing.T, dir string, config string) string {
+	t.Helper()
+	file := path.Join(dir, "schedule.yaml")
+	if err := ioutil.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadSchedule(t *testing.T) {
+	dir := useDataDir(t)
+	schedule, err := LoadSchedule(writeSchedule(t, dir, `
+tasks:
+  - job: dailyOnline
+    every: 6h
+    analysis: true
+    locations:
+      - country: Taiwan
+  - name: nightly
+    job: historyAll
+    at: "02:00"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.StatusFile != path.Join(dir, "schedule-status.json") {
+		t.Errorf("status file %s", schedule.StatusFile)
+	}
+	if len(schedule.Tasks) != 2 {
+		t.Fatalf("tasks %+v", schedule.Tasks)
+	}
+	daily := schedule.Tasks[0]
+	if daily.Name != "dailyOnline" || daily.Every != 6*time.Hour || !daily.Analysis || daily.Locations[0].Country != CdsTaiwan {
+		t.Errorf("task %+v", daily)
+	}
+	if locs := schedule.Tasks[1].locations(); len(locs) != len(registry) {
+		t.Errorf("locations %v, want every registered country", locs)
+	}
+
+	invalid := []string{
+		"tasks:\n  - job: dailyOnline\n",
+		"tasks:\n  - job: dailyOnline\n    every: 1h\n    at: \"02:00\"\n",
+		"tasks:\n  - job: dailyOnline\n    at: \"25:00\"\n",
+		"tasks:\n  - job: historyDownload\n    every: 1h\n    analysis: true\n",
+		"tasks:\n  - job: serve\n    every: 1h\n",
+		"tasks:\n  - job: api\n    every: 1h\n",
+		"tasks:\n  - job: dialy\n    every: 1h\n",
+		"tasks:\n  - job: daily\n    every: 1h\n  - job: daily\n    every: 2h\n",
+	}
+	for _, config := range invalid {
+		if _, err := LoadSchedule(writeSchedule(t, dir, config)); err == nil {
+			t.Errorf("expect error of %q", config)
+		}
+	}
+}
+
+func TestScheduleTaskDue(t *testing.T) {
+	last := time.Date(2020, 4, 20, 1, 0, 0, 0, time.UTC)
+	every := ScheduleTask{Every: 6 * time.Hour}
+	at := ScheduleTask{At: "02:00"}
+	cases := []struct {
+		task ScheduleTask
+		last time.Time
+		now  time.Time
+		due  bool
+	}{
+		{every, time.Time{}, last, true},
+		{every, last, last.Add(5 * time.Hour), false},
+		{every, last, last.Add(6 * time.Hour), true},
+		{at, last, last.Add(59 * time.Minute), false},
+		{at, last, last.Add(time.Hour), true},
+		{at, last.Add(time.Hour), last.Add(23 * time.Hour), false},
+		{at, last.Add(time.Hour), last.Add(25 * time.Hour), true},
+	}
+	for _, c := range cases {
+		if due := c.task.due(c.last, c.now); due != c.due {
+			t.Errorf("task %+v last %v now %v due %v, want %v", c.task, c.last, c.now, due, c.due)
+		}
+	}
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	dir := useDataDir(t)
+	schedule := Schedule{
+		StatusFile: path.Join(dir, "status.json"),
+		Tasks: []ScheduleTask{
+			{Name: "daily", Job: "dailyOnline", Every: 6 * time.Hour, Analysis: true, Locations: []ScheduleLocation{{Country: CdsTaiwan}, {Country: CdsIceland}}},
+			{Name: "download", Job: "historyDownload", At: "02:00"},
+		},
+	}
+	runs := []string{}
+	run := func(job string, loc PoliticalGeo) error {
+		runs = append(runs, job+":"+loc.Country)
+		if loc.Country == CdsIceland {
+			return os.ErrNotExist
+		}
+		return nil
+	}
+	scheduler, err := NewScheduler(schedule, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 4, 20, 3, 0, 0, 0, time.UTC)
+	if n := scheduler.RunDue(now); n != 2 {
+		t.Errorf("runs %d, want 2", n)
+	}
+	want := []string{"dailyOnline:Taiwan", "analysis:Taiwan", "dailyOnline:Iceland", "historyDownload:"}
+	if !equalStrings(runs, want) {
+		t.Errorf("runs %v, want %v", runs, want)
+	}
+	if status := scheduler.Status["daily"]; status.Status != TaskFail || status.LastStart != now {
+		t.Errorf("status %+v, want fail", status)
+	}
+	if status := scheduler.Status["download"]; status.Status != TaskOK {
+		t.Errorf("status %+v, want ok", status)
+	}
+
+	// a restarted scheduler continues from the persisted status
+	restarted, err := NewScheduler(schedule, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := restarted.RunDue(now.Add(time.Hour)); n != 0 {
+		t.Errorf("runs %d an hour later, want 0", n)
+	}
+	if n := restarted.RunDue(now.Add(6 * time.Hour)); n != 1 {
+		t.Errorf("runs %d 6 hours later, want 1", n)
+	}
+}
+
+func TestSchedulerAnalysisOfEveryCountry(t *testing.T) {
+	dir := useDataDir(t)
+	schedule := Schedule{
+		StatusFile: path.Join(dir, "status.json"),
+		Tasks: []ScheduleTask{
+			{Name: "daily", Job: "dailyOnline", Every: 6 * time.Hour, Analysis: true},
+			{Name: "county", Job: "dailyOnline", Every: 6 * time.Hour, Analysis: true, Locations: []ScheduleLocation{{Country: CdsUSA, State: "California", County: "Santa Clara County"}}},
+		},
+	}
+	runs := []string{}
+	scheduler, err := NewScheduler(schedule, func(job string, loc PoliticalGeo) error {
+		runs = append(runs, job+":"+loc.Country)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler.RunDue(time.Date(2020, 4, 20, 3, 0, 0, 0, time.UTC))
+	// the United States has no data-set without state and county, so every county of it is analysed
+	want := []string{
+		"dailyOnline:Iceland", "analysis:Iceland", "dailyOnline:Taiwan", "analysis:Taiwan", "dailyOnline:United States", "analysisAll:United States",
+		"dailyOnline:United States", "analysis:United States",
+	}
+	if !equalStrings(runs, want) {
+		t.Errorf("runs %v, want %v", runs, want)
+	}
+	for name, status := range scheduler.Status {
+		if status.Status != TaskOK {
+			t.Errorf("task %s status %+v, want ok", name, status)
+		}
+	}
+}
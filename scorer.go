@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	ScorerExponential   = "exponential"
+	ScorerMovingAverage = "movingAverage"
+	ScorerGrowthRatio   = "growthRatio"
+	ScorerDoublingTime  = "doublingTime"
+
+	defaultDecay   = 0.5
+	daysOfWeek     = 7
+	defaultScorers = ScorerExponential
+)
+
+// Scorer scores a window of daily new cases sorted by report_ts in ascending order
+type Scorer interface {
+	Name() string
+	Score(data []CDSScoreDataSet) float64
+}
+
+// NewScorers returns scorers of a comma separated list of names
+func NewScorers(names string, windowSize int, decay float64) ([]Scorer, error) {
+	scorers := []Scorer{}
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case ScorerExponential:
+			scorers = append(scorers, Exponiential{WindowSize: windowSize, Decay: decay})
+		case ScorerMovingAverage:
+			scorers = append(scorers, MovingAverage{Days: daysOfWeek})
+		case ScorerGrowthRatio:
+			scorers = append(scorers, GrowthRatio{Days: daysOfWeek})
+		case ScorerDoublingTime:
+			scorers = append(scorers, DoublingTime{Days: daysOfWeek})
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown scorer %s", name)
+		}
+	}
+	if 0 == len(scorers) {
+		return nil, fmt.Errorf("no scorer in %s", names)
+	}
+	return scorers, nil
+}
+
+// MovingAverage is the average of daily new cases of the last Days days
+type MovingAverage struct {
+	Days int
+}
+
+func (m MovingAverage) Name() string {
+	return ScorerMovingAverage
+}
+
+func (m MovingAverage) Score(data []CDSScoreDataSet) float64 {
+	days := m.Days
+	if days <= 0 {
+		days = daysOfWeek
+	}
+	if len(data) < days {
+		days = len(data)
+	}
+	if 0 == days {
+		return 0
+	}
+	return sumCases(data[len(data)-days:]) / float64(days)
+}
+
+// GrowthRatio is new cases of the last Days days over new cases of the Days days before.
+// An outbreak after days without a case grows without bound, so it is +Inf when there is no case in the days before,
+// and 1 when there is no case in both, as nothing changes.
+type GrowthRatio struct {
+	Days int
+}
+
+func (g GrowthRatio) Name() string {
+	return ScorerGrowthRatio
+}
+
+func (g GrowthRatio) Score(data []CDSScoreDataSet) float64 {
+	recent, previous := splitWeeks(data, g.Days)
+	if sumCases(previous) <= 0 {
+		if sumCases(recent) <= 0 {
+			return 1
+		}
+		return math.Inf(1)
+	}
+	return sumCases(recent) / sumCases(previous)
+}
+
+// DoublingTime is the number of days new cases take to double at the growth rate between the last Days days and the Days days before.
+// New cases which do not grow never double, so it is +Inf then, and the score falls as growth rises.
+// It is 0 for an outbreak after days without a case.
+type DoublingTime struct {
+	Days int
+}
+
+func (d DoublingTime) Name() string {
+	return ScorerDoublingTime
+}
+
+func (d DoublingTime) Score(data []CDSScoreDataSet) float64 {
+	recent, _ := splitWeeks(data, d.Days)
+	ratio := GrowthRatio{Days: d.Days}.Score(data)
+	if ratio <= 1 {
+		return math.Inf(1)
+	}
+	rate := math.Log(ratio) / float64(len(recent))
+	return math.Ln2 / rate
+}
+
+// splitWeeks returns the last days days of data and the days days before them.
+// When data is shorter than 2*days, data is split into two halves.
+func splitWeeks(data []CDSScoreDataSet, days int) ([]CDSScoreDataSet, []CDSScoreDataSet) {
+	if days <= 0 {
+		days = daysOfWeek
+	}
+	if len(data) < 2*days {
+		days = len(data) / 2
+		if 0 == days {
+			return data, nil
+		}
+	}
+	end := len(data)
+	return data[end-days:], data[end-2*days : end-days]
+}
+
+func sumCases(data []CDSScoreDataSet) float64 {
+	sum := float64(0)
+	for _, d := range data {
+		sum += d.Cases
+	}
+	return sum
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func newCases(cases ...float64) []CDSScoreDataSet {
+	data := []CDSScoreDataSet{}
+	for i, c := range cases {
+		data = append(data, CDSScoreDataSet{Name: "test", Cases: c, ReportTime: int64(i) * secondsOfDay})
+	}
+	return data
+}
+
+func constantCases(days int, cases float64) []CDSScoreDataSet {
+	values := make([]float64, days)
+	for i := range values {
+		values[i] = cases
+	}
+	return newCases(values...)
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestExponientialScore(t *testing.T) {
+	e := Exponiential{}
+	cases := []struct {
+		name  string
+		data  []CDSScoreDataSet
+		score float64
+	}{
+		{"no data", nil, 0},
+		{"no new cases", constantCases(14, 0), 100},
+		{"one case a day", constantCases(14, 1), 50},
+		{"short window is padded", constantCases(3, 0), 100},
+	}
+	for _, c := range cases {
+		if score := e.Score(c.data); !almostEqual(score, c.score) {
+			t.Errorf("%s: score %f, want %f", c.name, score, c.score)
+		}
+	}
+
+	rising := e.Score(newCases(0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 10))
+	falling := e.Score(newCases(10, 5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0))
+	if rising >= falling {
+		t.Errorf("rising score %f, want lower than falling score %f", rising, falling)
+	}
+	slow := Exponiential{Decay: 0.1}.Score(newCases(0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 10))
+	if slow <= rising {
+		t.Errorf("score of slow decay %f, want higher than %f", slow, rising)
+	}
+}
+
+func TestScorers(t *testing.T) {
+	doubling := newCases(1, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2)
+	cases := []struct {
+		scorer Scorer
+		data   []CDSScoreDataSet
+		score  float64
+	}{
+		{MovingAverage{Days: 7}, newCases(0, 0, 0, 7, 7, 7, 7, 7, 7, 7), 7},
+		{MovingAverage{Days: 7}, newCases(3, 6), 4.5},
+		{GrowthRatio{Days: 7}, doubling, 2},
+		{GrowthRatio{Days: 7}, constantCases(14, 0), 1},
+		{GrowthRatio{Days: 7}, newCases(1, 3), 3},
+		{GrowthRatio{Days: 7}, newCases(0, 0, 0, 0, 50, 0), math.Inf(1)},
+		{DoublingTime{Days: 7}, doubling, 7},
+		{DoublingTime{Days: 7}, constantCases(14, 3), math.Inf(1)},
+		{DoublingTime{Days: 7}, newCases(9, 3), math.Inf(1)},
+		{DoublingTime{Days: 7}, newCases(0, 0, 0, 0, 50, 0), 0},
+	}
+	for _, c := range cases {
+		if score := c.scorer.Score(c.data); score != c.score && !almostEqual(score, c.score) {
+			t.Errorf("%s of %v: score %f, want %f", c.scorer.Name(), c.data, score, c.score)
+		}
+	}
+}
+
+func TestNewScorers(t *testing.T) {
+	scorers, err := NewScorers("exponential, growthRatio,doublingTime,movingAverage", 21, 0.3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, s := range scorers {
+		names = append(names, s.Name())
+	}
+	if !equalStrings(names, []string{ScorerExponential, ScorerGrowthRatio, ScorerDoublingTime, ScorerMovingAverage}) {
+		t.Errorf("scorers %v", names)
+	}
+	if e := scorers[0].(Exponiential); e.WindowSize != 21 || e.Decay != 0.3 {
+		t.Errorf("exponential %+v, want window 21 decay 0.3", e)
+	}
+	if _, err := NewScorers("exponential,unknown", 14, 0.5); err == nil {
+		t.Error("expect unknown scorer error")
+	}
+	if _, err := NewScorers("", 14, 0.5); err == nil {
+		t.Error("expect no scorer error")
+	}
+}
+
+func TestDoublingTimeMonotone(t *testing.T) {
+	// faster growth doubles sooner
+	previous := math.Inf(1)
+	for _, recent := range []float64{10, 12, 20, 40, 80} {
+		data := append(constantCases(7, 10), constantCases(7, recent)...)
+		score := DoublingTime{Days: 7}.Score(data)
+		if score > previous || (score == previous && !math.IsInf(score, 1)) {
+			t.Errorf("doubling time %v of recent cases %v, want below %v", score, recent, previous)
+		}
+		previous = score
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Series is the daily value of a window which a scorer scores
+type Series string
+
+const (
+	// SeriesCases is daily new cases
+	SeriesCases Series = "cases"
+	// SeriesDeaths is daily new deaths
+	SeriesDeaths Series = "deaths"
+	// SeriesRecovered is daily new recovered
+	SeriesRecovered Series = "recovered"
+	// SeriesActive is the daily change of active cases. It is negative on days more patients recover or die than are confirmed.
+	SeriesActive Series = "active"
+
+	defaultSeries = "cases,deaths"
+)
+
+// ParseSeries returns series of a comma separated list of names
+func ParseSeries(names string) ([]Series, error) {
+	series := []Series{}
+	for _, name := range strings.Split(names, ",") {
+		switch s := Series(strings.TrimSpace(name)); s {
+		case SeriesCases, SeriesDeaths, SeriesRecovered, SeriesActive:
+			series = append(series, s)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown series %s", name)
+		}
+	}
+	if 0 == len(series) {
+		return nil, fmt.Errorf("no series in %s", names)
+	}
+	return series, nil
+}
+
+// of returns a copy of data whose Cases is the series, so scorers of cases score the series
+func (s Series) of(data []CDSScoreDataSet) []CDSScoreDataSet {
+	if SeriesCases == s {
+		return data
+	}
+	values := make([]CDSScoreDataSet, len(data))
+	for i, d := range data {
+		switch s {
+		case SeriesDeaths:
+			d.Cases = d.Deaths
+		case SeriesRecovered:
+			d.Cases = d.Recovered
+		case SeriesActive:
+			d.Cases = d.Active
+		}
+		values[i] = d
+	}
+	return values
+}
+
+// signed tells if the series can be negative, ie. the daily change of active cases
+func (s Series) signed() bool {
+	return SeriesActive == s
+}
+
+// SeriesScorer scores a series with Scorer
+type SeriesScorer struct {
+	Scorer
+	Series Series
+}
+
+func (s SeriesScorer) Score(data []CDSScoreDataSet) float64 {
+	return s.Scorer.Score(s.Series.of(data))
+}
+
+// ForSeries returns a scorer of each series for each scorer.
+// exponential, growthRatio and doublingTime assume non-negative new counts, so only movingAverage scores a signed series.
+func ForSeries(scorers []Scorer, series []Series) ([]Scorer, error) {
+	result := []Scorer{}
+	for _, s := range series {
+		for _, scorer := range scorers {
+			if _, ok := scorer.(MovingAverage); s.signed() && !ok {
+				return nil, fmt.Errorf("scorer %s cannot score series %s, which can be negative, use %s", scorer.Name(), s, ScorerMovingAverage)
+			}
+			result = append(result, SeriesScorer{Scorer: scorer, Series: s})
+		}
+	}
+	return result, nil
+}
+
+// seriesOf returns the series a scorer scores. A plain scorer scores cases.
+func seriesOf(scorer Scorer) Series {
+	if s, ok := scorer.(SeriesScorer); ok {
+		return s.Series
+	}
+	return SeriesCases
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseSeries(t *testing.T) {
+	series, err := ParseSeries(defaultSeries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 2 || series[0] != SeriesCases || series[1] != SeriesDeaths {
+		t.Errorf("series %v", series)
+	}
+	for _, names := range []string{"", "cases,tests"} {
+		if _, err := ParseSeries(names); err == nil {
+			t.Errorf("expect error of %q", names)
+		}
+	}
+}
+
+func TestContinuousDeltaSeries(t *testing.T) {
+	docs := []CDSScoreDataSet{}
+	// cumulative counts of 2020-04-01, 2020-04-02 and 2020-04-04 in descending order like the query
+	for _, d := range []struct {
+		date                             string
+		cases, deaths, recovered, active float64
+	}{
+		{"2020-04-04", 30, 4, 10, 16},
+		{"2020-04-02", 20, 2, 4, 14},
+		{"2020-04-01", 10, 1, 1, 8},
+	} {
+		reportTime, _ := convertDateToUTCTime(d.date)
+		docs = append(docs, CDSScoreDataSet{Name: "test", ReportTime: reportTime, ReportDate: d.date, Cases: d.cases, Deaths: d.deaths, Recovered: d.recovered, Active: d.active})
+	}
+	data := continuousDelta(docs, 14, GapInterpolate)
+	if len(data) != 3 {
+		t.Fatalf("data %+v, want 3 days", data)
+	}
+	want := []CDSScoreDataSet{
+		{Cases: 10, Deaths: 1, Recovered: 3, Active: 6},
+		{Cases: 5, Deaths: 1, Recovered: 3, Active: 1},
+		{Cases: 5, Deaths: 1, Recovered: 3, Active: 1},
+	}
+	for i, d := range data {
+		w := want[i]
+		if d.Cases != w.Cases || d.Deaths != w.Deaths || d.Recovered != w.Recovered || d.Active != w.Active {
+			t.Errorf("day %d %+v, want %+v", i, d, w)
+		}
+	}
+
+	scorer := SeriesScorer{Scorer: MovingAverage{Days: 3}, Series: SeriesActive}
+	if score := scorer.Score(data); !almostEqual(score, 8.0/3) {
+		t.Errorf("moving average of the daily change of active cases %f, want 8/3", score)
+	}
+	scorer.Series = SeriesRecovered
+	if score := scorer.Score(data); score != 3 {
+		t.Errorf("moving average of recovered %f, want 3", score)
+	}
+	if data[0].Cases != 10 {
+		t.Error("scoring a series modifies data")
+	}
+}
+
+func TestForSeries(t *testing.T) {
+	scorers, err := ForSeries([]Scorer{MovingAverage{}, GrowthRatio{}}, []Series{SeriesCases, SeriesDeaths})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scorers) != 4 {
+		t.Fatalf("scorers %d, want 4", len(scorers))
+	}
+	if scorers[3].Name() != ScorerGrowthRatio || seriesOf(scorers[3]) != SeriesDeaths {
+		t.Errorf("scorer %s of %s, want growthRatio of deaths", scorers[3].Name(), seriesOf(scorers[3]))
+	}
+	if seriesOf(MovingAverage{}) != SeriesCases {
+		t.Error("a plain scorer scores cases")
+	}
+}
+
+func TestForSeriesSigned(t *testing.T) {
+	for _, scorer := range []Scorer{Exponiential{WindowSize: 7}, GrowthRatio{Days: 7}, DoublingTime{Days: 7}} {
+		if _, err := ForSeries([]Scorer{scorer}, []Series{SeriesCases, SeriesActive}); err == nil {
+			t.Errorf("expect error of %s of active", scorer.Name())
+		}
+	}
+	scorers, err := ForSeries([]Scorer{MovingAverage{Days: 7}}, []Series{SeriesActive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// active cases recede, so the score is the negative average daily change
+	declining := []CDSScoreDataSet{}
+	for _, change := range []float64{2, 1, 0, -1, -2, -1, -1} {
+		declining = append(declining, CDSScoreDataSet{Cases: 5, Active: change})
+	}
+	if score := scorers[0].Score(declining); !almostEqual(score, -2.0/7) {
+		t.Errorf("moving average of declining active cases %v, want -2/7", score)
+	}
+}
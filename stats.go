@@ -0,0 +1,206 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// gammaP is the regularized lower incomplete gamma function P(a, x), the cumulative probability of x of a gamma distribution of shape a and scale 1
+func gammaP(a, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	lg, _ := math.Lgamma(a)
+	front := math.Exp(a*math.Log(x) - x - lg)
+	if x < a+1 {
+		// series
+		term := 1 / a
+		sum := term
+		for n := 1; n < 1000; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return sum * front
+	}
+	// continued fraction of Q(a, x) by the modified Lentz method
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for n := 1; n < 1000; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+	return 1 - front*h
+}
+
+// gammaQuantile is the p quantile of a gamma distribution of shape a and scale 1, found by bisection
+func gammaQuantile(a, p float64) float64 {
+	low, high := 0.0, math.Max(a, 1)
+	for gammaP(a, high) < p {
+		low = high
+		high *= 2
+	}
+	for i := 0; i < 200 && high-low > 1e-12*high; i++ {
+		mid := (low + high) / 2
+		if gammaP(a, mid) < p {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+// betaI is the regularized incomplete beta function I_x(a, b)
+func betaI(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	// the continued fraction converges fast below the mean, so the tail above it is taken by symmetry
+	if x > (a+1)/(a+b+2) {
+		return 1 - front*betaFraction(b, a, 1-x)/b
+	}
+	return front * betaFraction(a, b, x) / a
+}
+
+// betaFraction is the continued fraction of betaI by the modified Lentz method
+func betaFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m < 1000; m++ {
+		fm := float64(m)
+		for _, an := range []float64{
+			fm * (b - fm) * x / ((a + 2*fm - 1) * (a + 2*fm)),
+			-(a + fm) * (a + b + fm) * x / ((a + 2*fm) * (a + 2*fm + 1)),
+		} {
+			d = 1 + an*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + an/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+		}
+		if math.Abs(d*c-1) < 1e-15 {
+			break
+		}
+	}
+	return h
+}
+
+// studentT is the cumulative probability of t of a Student's t distribution of df degrees of freedom
+func studentT(df, t float64) float64 {
+	tail := betaI(df/2, 0.5, df/(df+t*t)) / 2
+	if t < 0 {
+		return tail
+	}
+	return 1 - tail
+}
+
+// studentTQuantile is the p quantile of a Student's t distribution of df degrees of freedom, found by bisection
+func studentTQuantile(df, p float64) float64 {
+	if p < 0.5 {
+		return -studentTQuantile(df, 1-p)
+	}
+	low, high := 0.0, 1.0
+	for studentT(df, high) < p {
+		low = high
+		high *= 2
+	}
+	for i := 0; i < 200 && high-low > 1e-12*high; i++ {
+		mid := (low + high) / 2
+		if studentT(df, mid) < p {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return (low + high) / 2
+}
+
+// spearman is the Spearman rank correlation of xs and ys. It is NaN when either has no spread.
+func spearman(xs, ys []float64) float64 {
+	if len(xs) != len(ys) || len(xs) < 2 {
+		return math.NaN()
+	}
+	return pearson(ranks(xs), ranks(ys))
+}
+
+// ranks returns the rank of each value from 1, and tied values share their average rank
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return values[order[a]] < values[order[b]]
+	})
+	result := make([]float64, len(values))
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && values[order[end]] == values[order[start]] {
+			end++
+		}
+		rank := float64(start+end+1) / 2
+		for _, i := range order[start:end] {
+			result[i] = rank
+		}
+		start = end
+	}
+	return result
+}
+
+func pearson(xs, ys []float64) float64 {
+	meanX, meanY := 0.0, 0.0
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+	sxy, sxx, syy := 0.0, 0.0, 0.0
+	for i := range xs {
+		sxy += (xs[i] - meanX) * (ys[i] - meanY)
+		sxx += (xs[i] - meanX) * (xs[i] - meanX)
+		syy += (ys[i] - meanY) * (ys[i] - meanY)
+	}
+	if 0 == sxx || 0 == syy {
+		return math.NaN()
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
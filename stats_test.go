@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGammaP(t *testing.T) {
+	for _, x := range []float64{0.1, 1, 2, 5} {
+		// shape 1 is the exponential distribution
+		if got, want := gammaP(1, x), 1-math.Exp(-x); math.Abs(got-want) > 1e-9 {
+			t.Errorf("P(1, %v) = %v, want %v", x, got, want)
+		}
+	}
+	if got := gammaP(10, 10); math.Abs(got-0.5420702855) > 1e-9 {
+		t.Errorf("P(10, 10) = %v", got)
+	}
+	if got := gammaQuantile(1, 0.5); math.Abs(got-math.Ln2) > 1e-9 {
+		t.Errorf("median of shape 1 = %v, want ln 2", got)
+	}
+	if got := gammaP(50, gammaQuantile(50, rtUpperQuantile)); math.Abs(got-rtUpperQuantile) > 1e-9 {
+		t.Errorf("P of the 97.5%% quantile = %v", got)
+	}
+}
+
+func TestStudentTQuantile(t *testing.T) {
+	// quantiles of t tables
+	for _, c := range []struct {
+		df, p, want float64
+	}{
+		{1, 0.975, 12.7062047},
+		{5, 0.975, 2.5705818},
+		{12, 0.975, 2.1788128},
+		{30, 0.95, 1.6972609},
+		{12, 0.025, -2.1788128},
+	} {
+		if got := studentTQuantile(c.df, c.p); math.Abs(got-c.want) > 1e-6 {
+			t.Errorf("quantile %v of df %v = %v, want %v", c.p, c.df, got, c.want)
+		}
+	}
+	if got := studentT(7, 0); !almostEqual(got, 0.5) {
+		t.Errorf("P(t <= 0) = %v, want 0.5", got)
+	}
+}
+
+func TestSpearman(t *testing.T) {
+	if got := spearman([]float64{1, 2, 3, 4}, []float64{10, 20, 25, 100}); !almostEqual(got, 1) {
+		t.Errorf("spearman of a monotonic relation %v, want 1", got)
+	}
+	if got := spearman([]float64{1, 2, 3}, []float64{3, 2, 1}); !almostEqual(got, -1) {
+		t.Errorf("spearman of a reversed relation %v, want -1", got)
+	}
+	if got := ranks([]float64{5, 1, 5, 3}); got[0] != 3.5 || got[1] != 1 || got[2] != 3.5 || got[3] != 2 {
+		t.Errorf("ranks %v, want tied values to share 3.5", got)
+	}
+	if got := spearman([]float64{1, 1, 1}, []float64{1, 2, 3}); !math.IsNaN(got) {
+		t.Errorf("spearman of constant values %v, want NaN", got)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+)
+
+const (
+	StoreMongo  = "mongo"
+	StoreFile   = "file"
+	StoreMemory = "memory"
+)
+
+// Store persists CDS records of a collection and queries them for analysis
+type Store interface {
+	// EnsureIndex makes records of a collection unique by name and report_ts
+	EnsureIndex(collection string) error
+	// Upsert replaces records by name and report_ts and inserts the missing ones. Both history and daily jobs write through it.
+	Upsert(collection string, records []CDSData) (UpsertResult, error)
+	// ContinuousData returns daily new cases of a location, like ContinuousDataCDSConfirm
+	ContinuousData(loc PoliticalGeo, windowSize int64, timeBefore int64, policy GapPolicy) ([]CDSScoreDataSet, error)
+	// Query returns records of loc whose report_ts is between from and to, sorted by name and report_ts.
+	// State and county of loc are optional, and to <= 0 means no upper bound.
+	Query(loc PoliticalGeo, from int64, to int64) ([]CDSData, error)
+	// Latest returns the latest record of each location of loc sorted by name. State and county of loc are optional.
+	Latest(loc PoliticalGeo) ([]CDSData, error)
+	// SaveForecasts replaces forecasts by name, model, report_ts and target_ts in the forecast collection and inserts the missing ones
+	SaveForecasts(forecasts []Forecast) (UpsertResult, error)
+	// Forecasts returns forecasts of loc made between from and to, sorted by name, report_ts, model and target_ts.
+	// State and county of loc are optional, and to <= 0 means no upper bound.
+	Forecasts(loc PoliticalGeo, from int64, to int64) ([]Forecast, error)
+	Close() error
+}
+
+// NewStore opens the store of kind. dir is used by the file store only.
+func NewStore(kind string, dir string, batchSize int) (Store, error) {
+	switch kind {
+	case StoreMongo:
+		return NewMongoStore(batchSize)
+	case StoreFile:
+		return NewFileStore(dir)
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store %s", kind)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dailySeries(name string, start string, cumulative ...float64) []CDSData {
+	records := []CDSData{}
+	startTime, _ := convertDateToUTCTime(start)
+	for i, cases := range cumulative {
+		reportTime := startTime + int64(i)*secondsOfDay
+		records = append(records, CDSData{
+			Name:           name,
+			Country:        name,
+			Level:          "country",
+			Cases:          cases,
+			ReportTime:     reportTime,
+			ReportTimeDate: time.Unix(reportTime, 0).UTC().Format(layoutISO),
+			Population:     100000,
+		})
+	}
+	return records
+}
+
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	collection := "ConfirmTaiwan"
+	if err := store.EnsureIndex(collection); err != nil {
+		t.Fatal(err)
+	}
+	records := dailySeries(CdsTaiwan, "2020-04-01", 10, 12, 15, 15, 20)
+	res, err := store.Upsert(collection, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (res != UpsertResult{Inserted: 5}) {
+		t.Errorf("first upsert %s, want 5 inserted", res)
+	}
+
+	corrected := dailySeries(CdsTaiwan, "2020-04-04", 16, 20, 26)
+	res, err = store.Upsert(collection, corrected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (res != UpsertResult{Inserted: 1, Modified: 1, Unchanged: 1}) {
+		t.Errorf("second upsert %s, want 1 inserted 1 modified 1 unchanged", res)
+	}
+
+	timeBefore, _ := convertDateToUTCTime("2020-04-05")
+	data, err := store.ContinuousData(PoliticalGeo{Country: CdsTaiwan}, 3, timeBefore, GapReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{3, 1, 4}
+	if len(data) != len(want) {
+		t.Fatalf("data %+v, want %d days", data, len(want))
+	}
+	for i, d := range data {
+		if d.Cases != want[i] {
+			t.Errorf("day %d new cases %f, want %f", i, d.Cases, want[i])
+		}
+	}
+	if data[2].ReportDate != "2020-04-05" {
+		t.Errorf("last report date %s, want 2020-04-05", data[2].ReportDate)
+	}
+
+	from, _ := convertDateToUTCTime("2020-04-02")
+	to, _ := convertDateToUTCTime("2020-04-04")
+	series, err := store.Query(PoliticalGeo{Country: CdsTaiwan}, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 3 || series[0].ReportTimeDate != "2020-04-02" || series[2].Cases != 16 {
+		t.Errorf("series %+v, want 3 days from 2020-04-02", series)
+	}
+	latest, err := store.Latest(PoliticalGeo{Country: CdsTaiwan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 1 || latest[0].ReportTimeDate != "2020-04-06" || latest[0].Cases != 26 {
+		t.Errorf("latest %+v, want 26 cases on 2020-04-06", latest)
+	}
+
+	forecasts := []Forecast{}
+	for i, date := range []string{"2020-04-06", "2020-04-05"} {
+		reportTime, _ := convertDateToUTCTime(date)
+		for h := 1; h <= 2; h++ {
+			forecasts = append(forecasts, Forecast{Name: CdsTaiwan, Country: CdsTaiwan, Model: ModelLogLinear, ReportTime: reportTime, TargetTime: reportTime + int64(h)*secondsOfDay, Horizon: h, Cases: float64(30 + i)})
+		}
+	}
+	if res, err := store.SaveForecasts(forecasts); err != nil || (res != UpsertResult{Inserted: 4}) {
+		t.Errorf("save forecasts %s error %v, want 4 inserted", res, err)
+	}
+	forecasts[0].Cases = 40
+	if res, _ := store.SaveForecasts(forecasts[:2]); (res != UpsertResult{Modified: 1, Unchanged: 1}) {
+		t.Errorf("save forecasts again %s, want 1 modified 1 unchanged", res)
+	}
+	saved, err := store.Forecasts(PoliticalGeo{Country: CdsTaiwan}, from, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 4 || saved[0].ReportTime != forecasts[2].ReportTime || saved[1].Horizon != 2 || saved[2].Cases != 40 {
+		t.Errorf("forecasts %+v, want 4 forecasts by report_ts and target_ts", saved)
+	}
+	if saved, _ := store.Forecasts(PoliticalGeo{Country: CdsTaiwan}, from, to); len(saved) != 0 {
+		t.Errorf("forecasts %+v made before 2020-04-04, want none", saved)
+	}
+	if saved, _ := store.Forecasts(PoliticalGeo{Country: CdsIceland}, 0, 0); len(saved) != 0 {
+		t.Errorf("forecasts %+v of Iceland, want none", saved)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+	lines := func() int {
+		data, _ := ioutil.ReadFile(path.Join(dir, "ConfirmTaiwan.jsonl"))
+		return strings.Count(string(data), "\n")
+	}
+	// upserts append inserted and modified records only
+	if n := lines(); n != 7 {
+		t.Errorf("lines %d, want 5 records and 2 upserted ones", n)
+	}
+
+	// the last line of a record wins without Close
+	reopened, _ := NewFileStore(dir)
+	res, err := reopened.Upsert("ConfirmTaiwan", dailySeries(CdsTaiwan, "2020-04-01", 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (res != UpsertResult{Unchanged: 1}) {
+		t.Errorf("upsert after reopen %s, want 1 unchanged", res)
+	}
+	if latest, _ := reopened.Latest(PoliticalGeo{Country: CdsTaiwan}); len(latest) != 1 || latest[0].Cases != 26 {
+		t.Errorf("latest %+v after reopen, want 26 cases", latest)
+	}
+	if err := reopened.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := lines(); n != 6 {
+		t.Errorf("lines %d after close, want 6 records", n)
+	}
+}